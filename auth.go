@@ -1,5 +1,49 @@
 package gohttp
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator authenticates the requests issued by a `gohttp.Client`.
+//
+// Authenticate is called on every attempt of a request, right before it is
+// sent, so it sees the serialized body and the headers set by middleware.
+// Implementations must be safe for concurrent use.
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// Refresher is implemented by authenticators whose credentials can be renewed.
+// When a request authenticated by a Refresher is rejected with a 401, the
+// client refreshes the credentials and transparently retries the request once.
+//
+// Refresh receives the rejected request, so that an implementation can skip
+// the refresh when its credentials already changed since the request was
+// authenticated, as happens when concurrent requests are rejected together.
+type Refresher interface {
+	Refresh(req *http.Request) error
+}
+
+// Challenger is implemented by authenticators that answer the challenge of a
+// 401 response. When a request authenticated by a Challenger is rejected with
+// a 401, the client hands it the response and, if the challenge is accepted,
+// transparently retries the request once.
+type Challenger interface {
+	Challenge(resp *Response) error
+}
+
+//------------------------------------------------------------------------------
+// Basic Authentication
+//------------------------------------------------------------------------------
+
 // BasicAuth models a set of basic authentication credentials.
 type BasicAuth struct {
 
@@ -8,3 +52,298 @@ type BasicAuth struct {
 	// Password for basic authentication.
 	Password string
 }
+
+// Authenticate sets the basic authentication credentials on the request.
+func (a *BasicAuth) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+//------------------------------------------------------------------------------
+// Bearer Token
+//------------------------------------------------------------------------------
+
+// BearerAuth models a static bearer token.
+type BearerAuth struct {
+
+	// Token is the bearer token.
+	Token string
+}
+
+// Authenticate sets the bearer token on the request.
+func (a *BearerAuth) Authenticate(req *http.Request) error {
+	req.Header.Set(Authorization, "Bearer "+a.Token)
+	return nil
+}
+
+//------------------------------------------------------------------------------
+// API Key
+//------------------------------------------------------------------------------
+
+// APIKeyLocation is the part of the request carrying an API key.
+type APIKeyLocation int
+
+// API key locations.
+const (
+	// APIKeyInHeader sends the API key as a request header.
+	APIKeyInHeader APIKeyLocation = iota
+
+	// APIKeyInQuery sends the API key as a query parameter.
+	APIKeyInQuery
+)
+
+// APIKeyAuth models an API key sent in a header or a query parameter.
+type APIKeyAuth struct {
+
+	// Name is the name of the header or query parameter.
+	Name string
+
+	// Key is the API key.
+	Key string
+
+	// In is the part of the request carrying the key.
+	In APIKeyLocation
+}
+
+// Authenticate sets the API key on the request.
+func (a *APIKeyAuth) Authenticate(req *http.Request) error {
+	if a.In == APIKeyInQuery {
+		query := req.URL.Query()
+		query.Set(a.Name, a.Key)
+		req.URL.RawQuery = query.Encode()
+		return nil
+	}
+	req.Header.Set(a.Name, a.Key)
+	return nil
+}
+
+//------------------------------------------------------------------------------
+// OAuth2
+//------------------------------------------------------------------------------
+
+// DefaultTokenExpiryDelta is how long before its expiry an OAuth2 access token
+// is refreshed.
+const DefaultTokenExpiryDelta = 30 * time.Second
+
+// DefaultTokenTimeout bounds the requests to the token endpoint of an
+// OAuth2Auth without an HTTPClient.
+const DefaultTokenTimeout = 30 * time.Second
+
+// defaultTokenClient reaches the token endpoint of an OAuth2Auth without an
+// HTTPClient.
+var defaultTokenClient = &http.Client{Timeout: DefaultTokenTimeout}
+
+// OAuth2 grant types.
+const (
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// OAuth2Token models an access token issued by an OAuth2 token endpoint.
+type OAuth2Token struct {
+
+	// AccessToken is the token sent with requests.
+	AccessToken string
+
+	// TokenType is the type of the token, usually "Bearer".
+	TokenType string
+
+	// RefreshToken is used to obtain a new access token, if issued.
+	RefreshToken string
+
+	// Expiry is when the access token expires. The zero time means it does not.
+	Expiry time.Time
+}
+
+// authorization returns the value of the `Authorization` header carrying the
+// token.
+func (t *OAuth2Token) authorization() string {
+	tokenType := t.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+// OAuth2Auth authenticates requests with an access token obtained from an
+// OAuth2 token endpoint, through the client credentials or the refresh token
+// grant. The token is cached and refreshed shortly before it expires.
+type OAuth2Auth struct {
+
+	// TokenURL is the token endpoint of the authorization server.
+	TokenURL string
+
+	// ClientID is the OAuth2 client identifier.
+	ClientID string
+
+	// ClientSecret is the OAuth2 client secret.
+	ClientSecret string
+
+	// Scopes are the requested scopes.
+	Scopes []string
+
+	// Grant is the grant type used to obtain tokens, GrantClientCredentials
+	// or GrantRefreshToken.
+	Grant string
+
+	// ClientAuthInBody sends the client credentials as form parameters
+	// instead of with basic authentication.
+	ClientAuthInBody bool
+
+	// ExpiryDelta is how long before its expiry a token is refreshed.
+	ExpiryDelta time.Duration
+
+	// HTTPClient is used to reach the token endpoint. When nil, a client
+	// timing out after DefaultTokenTimeout is used.
+	HTTPClient *http.Client
+
+	// mutex guards token and serializes token requests.
+	mutex sync.Mutex
+	token *OAuth2Token
+}
+
+// NewOAuth2ClientCredentials instantiates an OAuth2Auth using the client
+// credentials grant.
+func NewOAuth2ClientCredentials(tokenURL string, clientID string, clientSecret string, scopes ...string) *OAuth2Auth {
+	return &OAuth2Auth{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       scopes,
+		Grant:        GrantClientCredentials,
+		ExpiryDelta:  DefaultTokenExpiryDelta,
+	}
+}
+
+// NewOAuth2RefreshToken instantiates an OAuth2Auth using the refresh token
+// grant. Rotated refresh tokens returned by the server are kept.
+func NewOAuth2RefreshToken(tokenURL string, clientID string, clientSecret string, refreshToken string) *OAuth2Auth {
+	return &OAuth2Auth{
+		TokenURL:     tokenURL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Grant:        GrantRefreshToken,
+		ExpiryDelta:  DefaultTokenExpiryDelta,
+		token:        &OAuth2Token{RefreshToken: refreshToken},
+	}
+}
+
+// Authenticate sets a valid access token on the request, obtaining a new one
+// first if needed.
+func (a *OAuth2Auth) Authenticate(req *http.Request) error {
+	token, err := a.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set(Authorization, token.authorization())
+	return nil
+}
+
+// Token returns the cached access token, or a new one if it is missing or
+// about to expire.
+func (a *OAuth2Auth) Token(ctx context.Context) (*OAuth2Token, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.valid() {
+		return a.token, nil
+	}
+	return a.fetch(ctx)
+}
+
+// Refresh discards the cached access token and obtains a new one, unless the
+// token was already renewed since req was authenticated.
+func (a *OAuth2Auth) Refresh(req *http.Request) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.valid() && req.Header.Get(Authorization) != a.token.authorization() {
+		return nil
+	}
+	_, err := a.fetch(req.Context())
+	return err
+}
+
+func (a *OAuth2Auth) valid() bool {
+	if a.token == nil || a.token.AccessToken == "" {
+		return false
+	}
+	if a.token.Expiry.IsZero() {
+		return true
+	}
+	return time.Now().Add(a.ExpiryDelta).Before(a.token.Expiry)
+}
+
+// fetch requests a new token from the token endpoint. The mutex must be held.
+func (a *OAuth2Auth) fetch(ctx context.Context) (*OAuth2Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", a.Grant)
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+	if a.Grant == GrantRefreshToken {
+		if a.token == nil || a.token.RefreshToken == "" {
+			return nil, fmt.Errorf("gohttp: oauth2: no refresh token")
+		}
+		form.Set("refresh_token", a.token.RefreshToken)
+	}
+	if a.ClientAuthInBody {
+		form.Set("client_id", a.ClientID)
+		form.Set("client_secret", a.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, POST, a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(ContentType, "application/x-www-form-urlencoded")
+	req.Header.Set(Accept, "application/json")
+	if !a.ClientAuthInBody {
+		req.SetBasicAuth(url.QueryEscape(a.ClientID), url.QueryEscape(a.ClientSecret))
+	}
+
+	httpClient := a.HTTPClient
+	if httpClient == nil {
+		httpClient = defaultTokenClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !isSuccess(resp.StatusCode) {
+		return nil, fmt.Errorf("gohttp: oauth2: token endpoint returned %d: %s", resp.StatusCode, data)
+	}
+
+	var payload struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("gohttp: oauth2: decoding token: %w", err)
+	}
+	if payload.AccessToken == "" {
+		return nil, fmt.Errorf("gohttp: oauth2: token endpoint returned no access token")
+	}
+
+	token := &OAuth2Token{
+		AccessToken:  payload.AccessToken,
+		TokenType:    payload.TokenType,
+		RefreshToken: payload.RefreshToken,
+	}
+	if payload.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(payload.ExpiresIn) * time.Second)
+	}
+	if token.RefreshToken == "" && a.token != nil {
+		token.RefreshToken = a.token.RefreshToken
+	}
+	a.token = token
+	return token, nil
+}
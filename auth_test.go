@@ -0,0 +1,304 @@
+package gohttp
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type AuthTest struct {
+	server *httptest.Server
+
+	// tokensIssued counts the tokens issued by the token endpoint.
+	tokensIssued int32
+
+	// expiresIn is the lifetime, in seconds, of the issued tokens.
+	expiresIn int64
+
+	// challengesIssued counts the digest challenges sent by the server.
+	challengesIssued int32
+
+	// digestNonce is the nonce the server currently accepts, and digestCount
+	// the last nonce count it saw.
+	digestNonce string
+	digestCount int64
+}
+
+var _ = check.Suite(&AuthTest{})
+
+func (a *AuthTest) SetUpSuite(c *check.C) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", a.handleToken)
+	mux.HandleFunc("/protected", a.handleProtected)
+	mux.HandleFunc("/echo", HandleEchoAuth)
+	mux.HandleFunc("/digest", a.handleDigest)
+	a.server = httptest.NewServer(mux)
+}
+
+func (a *AuthTest) SetUpTest(c *check.C) {
+	atomic.StoreInt32(&a.tokensIssued, 0)
+	a.expiresIn = 3600
+	atomic.StoreInt32(&a.challengesIssued, 0)
+	a.digestNonce = "nonce-1"
+	a.digestCount = 0
+}
+
+func (a *AuthTest) TearDownSuite(c *check.C) {
+	a.server.Close()
+}
+
+func (a *AuthTest) TestBearerAuth(c *check.C) {
+	client := NewClient(a.server.URL, nil)
+	client.Authenticator = &BearerAuth{Token: "secret"}
+	response, err := client.Execute(&Request{Method: GET, URL: "/echo"})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(response.Data), check.Equals, "Bearer secret||")
+}
+
+func (a *AuthTest) TestAPIKeyAuth(c *check.C) {
+	client := NewClient(a.server.URL, nil)
+	client.Authenticator = &APIKeyAuth{Name: "X-Api-Key", Key: "secret"}
+	response, err := client.Execute(&Request{Method: GET, URL: "/echo"})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(response.Data), check.Equals, "|secret|")
+
+	client = NewClient(a.server.URL, nil)
+	client.Authenticator = &APIKeyAuth{Name: "api_key", Key: "secret", In: APIKeyInQuery}
+	request := &Request{Method: GET, URL: "/echo"}
+	request.SetParam("page", "2")
+	response, err = client.Execute(request)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(response.Data), check.Equals, "||api_key=secret&page=2")
+}
+
+func (a *AuthTest) TestOAuth2ClientCredentialsCachesToken(c *check.C) {
+	client := NewClient(a.server.URL, nil)
+	client.Authenticator = NewOAuth2ClientCredentials(a.server.URL+"/token", "id", "secret", "read")
+
+	for i := 0; i < 3; i++ {
+		response, err := client.Execute(&Request{Method: GET, URL: "/protected"})
+		c.Assert(err, check.IsNil)
+		c.Assert(response.Code, check.Equals, http.StatusOK)
+	}
+	c.Assert(atomic.LoadInt32(&a.tokensIssued), check.Equals, int32(1))
+}
+
+func (a *AuthTest) TestOAuth2RefreshesBeforeExpiry(c *check.C) {
+	a.expiresIn = 10
+	auth := NewOAuth2ClientCredentials(a.server.URL+"/token", "id", "secret")
+	auth.ExpiryDelta = time.Minute
+
+	client := NewClient(a.server.URL, nil)
+	client.Authenticator = auth
+	for i := 0; i < 2; i++ {
+		_, err := client.Execute(&Request{Method: GET, URL: "/protected"})
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(atomic.LoadInt32(&a.tokensIssued), check.Equals, int32(2))
+}
+
+func (a *AuthTest) TestOAuth2RefreshTokenGrant(c *check.C) {
+	auth := NewOAuth2RefreshToken(a.server.URL+"/token", "id", "secret", "refresh-0")
+	client := NewClient(a.server.URL, nil)
+	client.Authenticator = auth
+
+	response, err := client.Execute(&Request{Method: GET, URL: "/protected"})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+
+	token, err := auth.Token(context.Background())
+	c.Assert(err, check.IsNil)
+	c.Assert(token.RefreshToken, check.Equals, "refresh-1")
+}
+
+func (a *AuthTest) TestOAuth2RetriesOnceAfterUnauthorized(c *check.C) {
+	auth := NewOAuth2ClientCredentials(a.server.URL+"/token", "id", "secret")
+	client := NewClient(a.server.URL, nil)
+	client.Authenticator = auth
+
+	_, err := client.Execute(&Request{Method: GET, URL: "/protected"})
+	c.Assert(err, check.IsNil)
+
+	// Revoke the cached token server side by issuing a new one behind the
+	// client's back.
+	atomic.AddInt32(&a.tokensIssued, 1)
+
+	response, err := client.Execute(&Request{Method: POST, URL: "/protected", Body: map[string]interface{}{"a": 1}})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(string(response.Data), check.Equals, `{"a":1}`)
+	c.Assert(atomic.LoadInt32(&a.tokensIssued), check.Equals, int32(3))
+}
+
+func (a *AuthTest) TestOAuth2RefreshesOnceForConcurrentUnauthorized(c *check.C) {
+	auth := NewOAuth2ClientCredentials(a.server.URL+"/token", "id", "secret")
+	client := NewClient(a.server.URL, nil)
+	client.Authenticator = auth
+
+	_, err := client.Execute(&Request{Method: GET, URL: "/protected"})
+	c.Assert(err, check.IsNil)
+	atomic.AddInt32(&a.tokensIssued, 1)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 8)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			response, err := client.Execute(&Request{Method: GET, URL: "/protected"})
+			if err == nil {
+				codes[i] = response.Code
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		c.Assert(code, check.Equals, http.StatusOK)
+	}
+	c.Assert(atomic.LoadInt32(&a.tokensIssued), check.Equals, int32(3))
+}
+
+func (a *AuthTest) TestOAuth2DefaultClientTimesOut(c *check.C) {
+	c.Assert(defaultTokenClient.Timeout, check.Equals, DefaultTokenTimeout)
+	c.Assert(defaultTokenClient, check.Not(check.Equals), http.DefaultClient)
+}
+
+func (a *AuthTest) TestDigestAuthRFC7616(c *check.C) {
+	challenge, ok := parseDigestChallenge(`Digest realm="http-auth@example.org", qop="auth, auth-int", ` +
+		`algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", ` +
+		`opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(challenge.qop, check.Equals, "auth")
+	challenge.count = 1
+
+	cnonce := "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+	header := challenge.authorization("Mufasa", "Circle of Life", GET, "/dir/index.html", cnonce)
+	c.Assert(parseAuthParams(header[len("Digest "):])["response"], check.Equals, "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1")
+
+	challenge.algorithm = "MD5"
+	header = challenge.authorization("Mufasa", "Circle of Life", GET, "/dir/index.html", cnonce)
+	params := parseAuthParams(header[len("Digest "):])
+	c.Assert(params["response"], check.Equals, "8ca523f5e9506fed4657c9700eebdbec")
+	c.Assert(params["nc"], check.Equals, "00000001")
+	c.Assert(params["opaque"], check.Equals, "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS")
+}
+
+func (a *AuthTest) TestDigestAuthRejectsUnsupportedChallenge(c *check.C) {
+	auth := &DigestAuth{Username: "user", Password: "pass"}
+	resp := &Response{Header: http.Header{WWWAuthenticate: {`Basic realm="test"`, `Digest realm="test", nonce="n", algorithm=SHA-512-256`}}}
+	c.Assert(auth.Challenge(resp), check.Equals, ErrUnsupportedChallenge)
+}
+
+func (a *AuthTest) TestDigestAuthCachesNonce(c *check.C) {
+	client := NewClient(a.server.URL, nil)
+	client.Authenticator = &DigestAuth{Username: "user", Password: "pass"}
+
+	for i := 0; i < 3; i++ {
+		response, err := client.Execute(&Request{Method: POST, URL: "/digest?page=1", Body: map[string]interface{}{"a": i}})
+		c.Assert(err, check.IsNil)
+		c.Assert(response.Code, check.Equals, http.StatusOK)
+		c.Assert(string(response.Data), check.Equals, fmt.Sprintf(`{"a":%d}`, i))
+	}
+	c.Assert(atomic.LoadInt32(&a.challengesIssued), check.Equals, int32(1))
+	c.Assert(a.digestCount, check.Equals, int64(3))
+
+	// A new nonce is answered with a single additional challenge.
+	a.digestNonce, a.digestCount = "nonce-2", 0
+	response, err := client.Execute(&Request{Method: GET, URL: "/digest"})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(atomic.LoadInt32(&a.challengesIssued), check.Equals, int32(2))
+	c.Assert(a.digestCount, check.Equals, int64(1))
+}
+
+func (a *AuthTest) TestDigestAuthWrongPassword(c *check.C) {
+	client := NewClient(a.server.URL, nil)
+	client.Authenticator = &DigestAuth{Username: "user", Password: "wrong"}
+
+	response, err := client.Execute(&Request{Method: GET, URL: "/digest"})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusUnauthorized)
+	c.Assert(atomic.LoadInt32(&a.challengesIssued), check.Equals, int32(2))
+}
+
+//------------------------------------------------------------------------------
+// Handlers
+//------------------------------------------------------------------------------
+
+func (a *AuthTest) handleToken(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != "id" || secret != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	r.ParseForm()
+
+	issued := atomic.AddInt32(&a.tokensIssued, 1)
+	payload := map[string]interface{}{
+		"access_token": fmt.Sprintf("token-%d", issued),
+		"token_type":   "bearer",
+		"expires_in":   a.expiresIn,
+	}
+	if r.Form.Get("grant_type") == GrantRefreshToken {
+		payload["refresh_token"] = fmt.Sprintf("refresh-%d", issued)
+	}
+	data, _ := json.Marshal(payload)
+	w.Header().Set(ContentType, "application/json")
+	w.Write(data)
+}
+
+func (a *AuthTest) handleProtected(w http.ResponseWriter, r *http.Request) {
+	expected := fmt.Sprintf("Bearer token-%d", atomic.LoadInt32(&a.tokensIssued))
+	if r.Header.Get(Authorization) != expected {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Write(body)
+}
+
+// handleDigest verifies MD5 digest credentials for "user" and "pass", and
+// requires strictly increasing nonce counts.
+func (a *AuthTest) handleDigest(w http.ResponseWriter, r *http.Request) {
+	h := func(data string) string {
+		sum := md5.Sum([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+
+	params := parseAuthParams(strings.TrimPrefix(r.Header.Get(Authorization), "Digest "))
+	count, _ := strconv.ParseInt(params["nc"], 16, 64)
+	ha1 := h("user:test:pass")
+	ha2 := h(r.Method + ":" + r.URL.RequestURI())
+	expected := h(strings.Join([]string{ha1, a.digestNonce, params["nc"], params["cnonce"], "auth", ha2}, ":"))
+
+	if params["nonce"] != a.digestNonce || params["uri"] != r.URL.RequestURI() ||
+		params["response"] != expected || count <= a.digestCount {
+		atomic.AddInt32(&a.challengesIssued, 1)
+		w.Header().Set(WWWAuthenticate, fmt.Sprintf(`Digest realm="test", qop="auth", algorithm=MD5, nonce="%s", opaque="opaque"`, a.digestNonce))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	a.digestCount = count
+	w.WriteHeader(http.StatusOK)
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Write(body)
+}
+
+func HandleEchoAuth(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(r.Header.Get(Authorization) + "|" + r.Header.Get("X-Api-Key") + "|" + r.URL.RawQuery))
+}
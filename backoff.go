@@ -34,3 +34,71 @@ func Backoff() *backoff.ExponentialBackOff {
 	b.Reset()
 	return b
 }
+
+// BackoffOptions overrides the backoff policy of a `gohttp.Client` for a
+// single `gohttp.Request`. Zero valued fields inherit the client's setting.
+type BackoffOptions struct {
+
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int
+
+	// InitialInterval is the delay before the first retry.
+	InitialInterval time.Duration
+
+	// MaxInterval caps the delay between two retries.
+	MaxInterval time.Duration
+
+	// MaxElapsedTime is the total time budget after which retrying stops.
+	MaxElapsedTime time.Duration
+
+	// Multiplier is the factor by which the delay grows after each retry.
+	Multiplier float64
+}
+
+// newBackoff derives an independent backoff.BackOff from the template policy
+// and the optional per request overrides. The template is never mutated, so
+// a single template can be shared by concurrent requests.
+func newBackoff(template *backoff.ExponentialBackOff, opts *BackoffOptions) backoff.BackOff {
+	if template == nil {
+		template = Backoff()
+	}
+
+	b := &backoff.ExponentialBackOff{
+		InitialInterval:     template.InitialInterval,
+		RandomizationFactor: template.RandomizationFactor,
+		Multiplier:          template.Multiplier,
+		MaxInterval:         template.MaxInterval,
+		MaxElapsedTime:      template.MaxElapsedTime,
+		Clock:               template.Clock,
+	}
+	if b.Clock == nil {
+		b.Clock = backoff.SystemClock
+	}
+
+	if opts == nil {
+		b.Reset()
+		return b
+	}
+
+	if opts.InitialInterval > 0 {
+		b.InitialInterval = opts.InitialInterval
+	}
+	if opts.MaxInterval > 0 {
+		b.MaxInterval = opts.MaxInterval
+	}
+	if opts.MaxElapsedTime > 0 {
+		b.MaxElapsedTime = opts.MaxElapsedTime
+	}
+	if opts.Multiplier > 0 {
+		b.Multiplier = opts.Multiplier
+	}
+	b.Reset()
+
+	switch {
+	case opts.MaxAttempts == 1:
+		return &backoff.StopBackOff{}
+	case opts.MaxAttempts > 1:
+		return backoff.WithMaxRetries(b, uint64(opts.MaxAttempts-1))
+	}
+	return b
+}
@@ -0,0 +1,68 @@
+package gohttp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cenk/backoff"
+	"gopkg.in/check.v1"
+)
+
+type BackoffTest struct{}
+
+var _ = check.Suite(&BackoffTest{})
+
+func (b *BackoffTest) TestNewBackoffDoesNotMutateTemplate(c *check.C) {
+	template := Backoff()
+	before := *template
+
+	policy := newBackoff(template, &BackoffOptions{InitialInterval: time.Second, Multiplier: 3})
+	for i := 0; i < 5; i++ {
+		policy.NextBackOff()
+	}
+	c.Assert(policy, check.Not(check.Equals), template)
+	c.Assert(*template, check.DeepEquals, before)
+}
+
+func (b *BackoffTest) TestNewBackoffIsSafeForConcurrentUse(c *check.C) {
+	template := Backoff()
+	before := *template
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			opts := &BackoffOptions{MaxAttempts: i%4 + 1, InitialInterval: time.Duration(i+1) * time.Millisecond}
+			policy := newBackoff(template, opts)
+			for j := 0; j < 5; j++ {
+				policy.NextBackOff()
+			}
+			policy.Reset()
+		}(i)
+	}
+	wg.Wait()
+	c.Assert(*template, check.DeepEquals, before)
+}
+
+func (b *BackoffTest) TestNewBackoffWithOverrides(c *check.C) {
+	policy := newBackoff(Backoff(), &BackoffOptions{
+		InitialInterval: time.Second,
+		MaxElapsedTime:  time.Minute,
+	})
+	exponential, ok := policy.(*backoff.ExponentialBackOff)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(exponential.InitialInterval, check.Equals, time.Second)
+	c.Assert(exponential.MaxElapsedTime, check.Equals, time.Minute)
+	c.Assert(exponential.MaxInterval, check.Equals, DefaultMaxInterval)
+}
+
+func (b *BackoffTest) TestNewBackoffWithMaxAttempts(c *check.C) {
+	policy := newBackoff(Backoff(), &BackoffOptions{MaxAttempts: 3})
+	c.Assert(policy.NextBackOff(), check.Not(check.Equals), backoff.Stop)
+	c.Assert(policy.NextBackOff(), check.Not(check.Equals), backoff.Stop)
+	c.Assert(policy.NextBackOff(), check.Equals, backoff.Stop)
+
+	single := newBackoff(Backoff(), &BackoffOptions{MaxAttempts: 1})
+	c.Assert(single.NextBackOff(), check.Equals, backoff.Stop)
+}
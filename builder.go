@@ -0,0 +1,271 @@
+package gohttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMissingPathParam is returned when a placeholder of the URL of a request
+// has no matching path parameter.
+var ErrMissingPathParam = errors.New("gohttp: missing path parameter")
+
+// ErrInvalidPathParam is returned when a path parameter is a dot segment,
+// which would resolve the URL of a request to another endpoint.
+var ErrInvalidPathParam = errors.New("gohttp: invalid path parameter")
+
+// ArrayStyle controls how slices are encoded as query parameters.
+type ArrayStyle int
+
+// Array styles.
+const (
+	// ArrayRepeat repeats the key for every value: ids=1&ids=2.
+	ArrayRepeat ArrayStyle = iota
+
+	// ArrayBrackets suffixes the key with brackets: ids[]=1&ids[]=2.
+	ArrayBrackets
+
+	// ArrayIndex suffixes the key with the index of the value: ids[0]=1&ids[1]=2.
+	ArrayIndex
+
+	// ArrayComma joins the values with commas: ids=1,2.
+	ArrayComma
+
+	// ArrayPipe joins the values with pipes: ids=1|2.
+	ArrayPipe
+)
+
+// TimeFormat is the layout of `time.Time` path and query parameters.
+const TimeFormat = time.RFC3339
+
+//------------------------------------------------------------------------------
+// Request Builder
+//------------------------------------------------------------------------------
+
+// RequestBuilder builds a `gohttp.Request` fluently.
+//
+//	request, err := gohttp.NewRequest(gohttp.GET, "/users/{id}/posts").
+//		PathParam("id", 42).
+//		Query("limit", 10).
+//		Build()
+//
+// Path and query parameters accept strings, integers, floats, booleans,
+// `time.Time` values, formatted with TimeFormat, and `fmt.Stringer` values.
+// Query parameters also accept slices of those, encoded with the current
+// ArrayStyle. Errors are reported by Build.
+type RequestBuilder struct {
+	request *Request
+	style   ArrayStyle
+	err     error
+}
+
+// NewRequest starts building a request. The URL may contain placeholders,
+// such as "/users/{id}", filled by PathParam.
+func NewRequest(method string, url string) *RequestBuilder {
+	return &RequestBuilder{request: &Request{Method: method, URL: url}}
+}
+
+// PathParam fills the placeholder name of the URL with value. The value is
+// escaped as a single path segment.
+func (b *RequestBuilder) PathParam(name string, value interface{}) *RequestBuilder {
+	formatted, err := formatParam(value)
+	if err != nil {
+		return b.fail(fmt.Errorf("gohttp: path parameter %q: %w", name, err))
+	}
+	b.request.SetPathParam(name, formatted)
+	return b
+}
+
+// ArrayStyle sets the encoding of the slices passed to the following calls to
+// Query. The default is ArrayRepeat.
+func (b *RequestBuilder) ArrayStyle(style ArrayStyle) *RequestBuilder {
+	b.style = style
+	return b
+}
+
+// Query adds a query parameter.
+func (b *RequestBuilder) Query(key string, value interface{}) *RequestBuilder {
+	params, err := queryParams(key, value, b.style)
+	if err != nil {
+		return b.fail(fmt.Errorf("gohttp: query parameter %q: %w", key, err))
+	}
+	b.request.Params = append(b.request.Params, params...)
+	return b
+}
+
+// Header adds a header.
+func (b *RequestBuilder) Header(key string, value string) *RequestBuilder {
+	if b.request.Header == nil {
+		b.request.Header = http.Header{}
+	}
+	b.request.Header.Add(key, value)
+	return b
+}
+
+// Body sets the body of the request, encoded as contentType. See
+// `Request.Body` for the supported bodies.
+func (b *RequestBuilder) Body(body interface{}, contentType string) *RequestBuilder {
+	b.request.Body = body
+	b.request.ContentType = contentType
+	return b
+}
+
+// JSON sets a body sent as application/json.
+func (b *RequestBuilder) JSON(body interface{}) *RequestBuilder {
+	return b.Body(body, MediaTypeJSON)
+}
+
+// XML sets a body sent as application/xml.
+func (b *RequestBuilder) XML(body interface{}) *RequestBuilder {
+	return b.Body(body, MediaTypeXML)
+}
+
+// Form sets a form sent as application/x-www-form-urlencoded.
+func (b *RequestBuilder) Form(form interface{}) *RequestBuilder {
+	b.request.Form = form
+	return b
+}
+
+// Build returns the request, or the first error met while building it. Every
+// placeholder of the URL must be filled.
+func (b *RequestBuilder) Build() (*Request, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if _, err := b.request.expandPath(); err != nil {
+		return nil, err
+	}
+	return b.request, nil
+}
+
+func (b *RequestBuilder) fail(err error) *RequestBuilder {
+	if b.err == nil {
+		b.err = err
+	}
+	return b
+}
+
+//------------------------------------------------------------------------------
+// Path Templating
+//------------------------------------------------------------------------------
+
+// expandPath fills the placeholders in the path of the URL with the escaped
+// path params. Braces in the query or fragment are left as is.
+func (r *Request) expandPath() (string, error) {
+	rest, suffix := r.URL, ""
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest, suffix = rest[:i], rest[i:]
+	}
+	if !strings.Contains(rest, "{") {
+		return r.URL, nil
+	}
+
+	var expanded strings.Builder
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			expanded.WriteString(rest)
+			expanded.WriteString(suffix)
+			return expanded.String(), nil
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("gohttp: unterminated placeholder in %q", r.URL)
+		}
+
+		name := rest[start+1 : start+end]
+		value, ok := r.PathParams[name]
+		if !ok {
+			return "", fmt.Errorf("%w %q in %q", ErrMissingPathParam, name, r.URL)
+		}
+		if value == "." || value == ".." {
+			return "", fmt.Errorf("%w %q: %q", ErrInvalidPathParam, name, value)
+		}
+		expanded.WriteString(rest[:start])
+		expanded.WriteString(url.PathEscape(value))
+		rest = rest[start+end+1:]
+	}
+}
+
+//------------------------------------------------------------------------------
+// Parameter Encoding
+//------------------------------------------------------------------------------
+
+// queryParams encodes a query value, expanding slices with style.
+func queryParams(key string, value interface{}, style ArrayStyle) ([]Param, error) {
+	rv := reflect.ValueOf(value)
+	isList := rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array
+	if !isList || rv.Type().Elem().Kind() == reflect.Uint8 {
+		formatted, err := formatParam(value)
+		if err != nil {
+			return nil, err
+		}
+		return []Param{{Key: key, Value: formatted}}, nil
+	}
+
+	values := make([]string, rv.Len())
+	for i := range values {
+		formatted, err := formatParam(rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		values[i] = formatted
+	}
+
+	var params []Param
+	switch style {
+	case ArrayComma:
+		params = append(params, Param{Key: key, Value: strings.Join(values, ",")})
+	case ArrayPipe:
+		params = append(params, Param{Key: key, Value: strings.Join(values, "|")})
+	default:
+		for i, value := range values {
+			name := key
+			if style == ArrayBrackets {
+				name = key + "[]"
+			} else if style == ArrayIndex {
+				name = fmt.Sprintf("%s[%d]", key, i)
+			}
+			params = append(params, Param{Key: name, Value: value})
+		}
+	}
+	return params, nil
+}
+
+// formatParam formats a scalar path or query value.
+func formatParam(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return v.Format(TimeFormat), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	}
+	return "", fmt.Errorf("unsupported type %T", value)
+}
@@ -0,0 +1,145 @@
+package gohttp
+
+import (
+	"errors"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type BuilderTest struct{}
+
+var _ = check.Suite(&BuilderTest{})
+
+type builderStatus string
+
+func (s builderStatus) String() string {
+	return "status:" + string(s)
+}
+
+func (b *BuilderTest) TestBuildRequest(c *check.C) {
+	request, err := NewRequest(POST, "/users/{id}/posts").
+		PathParam("id", 42).
+		Query("limit", 10).
+		Query("draft", false).
+		Header(Accept, "application/json").
+		JSON(map[string]interface{}{"title": "hello"}).
+		Build()
+	c.Assert(err, check.IsNil)
+
+	translated, err := request.Translate(NewClient("https://api.example.com", nil))
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.URL.String(), check.Equals, "https://api.example.com/users/42/posts?draft=false&limit=10")
+	c.Assert(translated.Header.Get(Accept), check.Equals, "application/json")
+	c.Assert(translated.Header.Get(ContentType), check.Equals, "application/json")
+	body, _ := ioutil.ReadAll(translated.Body)
+	c.Assert(string(body), check.Equals, `{"title":"hello"}`)
+}
+
+func (b *BuilderTest) TestPathParamsAreEscaped(c *check.C) {
+	request, err := NewRequest(GET, "/files/{name}/{version}").
+		PathParam("name", "a b/c?d").
+		PathParam("version", uint8(3)).
+		Build()
+	c.Assert(err, check.IsNil)
+
+	translated, err := request.Translate(NewClient("https://api.example.com", nil))
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.URL.EscapedPath(), check.Equals, "/files/a%20b%2Fc%3Fd/3")
+	c.Assert(translated.URL.RawQuery, check.Equals, "")
+}
+
+func (b *BuilderTest) TestMissingPathParam(c *check.C) {
+	_, err := NewRequest(GET, "/users/{id}/posts/{post}").PathParam("id", 1).Build()
+	c.Assert(errors.Is(err, ErrMissingPathParam), check.Equals, true)
+	c.Assert(err, check.ErrorMatches, `.*"post".*`)
+
+	_, err = NewRequest(GET, "/users/{id").Build()
+	c.Assert(err, check.ErrorMatches, "gohttp: unterminated placeholder.*")
+
+	request := &Request{Method: GET, URL: "/users/{id}"}
+	_, err = request.Translate(NewClient("", nil))
+	c.Assert(errors.Is(err, ErrMissingPathParam), check.Equals, true)
+
+	request.SetPathParam("id", "7")
+	translated, err := request.Translate(NewClient("", nil))
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.URL.Path, check.Equals, "/users/7")
+}
+
+func (b *BuilderTest) TestDotSegmentPathParams(c *check.C) {
+	for _, value := range []string{".", ".."} {
+		_, err := NewRequest(DELETE, "/users/{id}/sessions").PathParam("id", value).Build()
+		c.Assert(errors.Is(err, ErrInvalidPathParam), check.Equals, true)
+
+		request := &Request{Method: DELETE, URL: "/users/{id}/sessions", PathParams: map[string]string{"id": value}}
+		_, err = request.Translate(NewClient("https://api.example.com/v1", nil))
+		c.Assert(errors.Is(err, ErrInvalidPathParam), check.Equals, true)
+	}
+
+	request, err := NewRequest(GET, "/files/{name}").PathParam("name", "..a").Build()
+	c.Assert(err, check.IsNil)
+	translated, err := request.Translate(NewClient("https://api.example.com/v1", nil))
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.URL.Path, check.Equals, "/v1/files/..a")
+}
+
+func (b *BuilderTest) TestBracesOutsideThePath(c *check.C) {
+	request := &Request{Method: GET, URL: "/search?q={x}#{y}"}
+	translated, err := request.Translate(NewClient("https://api.example.com", nil))
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.URL.Path, check.Equals, "/search")
+	c.Assert(translated.URL.Query().Get("q"), check.Equals, "{x}")
+
+	built, err := NewRequest(GET, "/users/{id}?fields={name}").PathParam("id", 7).Build()
+	c.Assert(err, check.IsNil)
+	translated, err = built.Translate(NewClient("https://api.example.com", nil))
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.URL.Path, check.Equals, "/users/7")
+	c.Assert(translated.URL.Query().Get("fields"), check.Equals, "{name}")
+}
+
+func (b *BuilderTest) TestTypedQueryValues(c *check.C) {
+	at := time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+	request, err := NewRequest(GET, "/search").
+		Query("int", -3).
+		Query("uint", uint64(7)).
+		Query("float", 1.5).
+		Query("bool", true).
+		Query("time", at).
+		Query("duration", 90*time.Second).
+		Query("stringer", builderStatus("open")).
+		Build()
+	c.Assert(err, check.IsNil)
+	c.Assert(request.Params, check.DeepEquals, []Param{
+		{Key: "int", Value: "-3"},
+		{Key: "uint", Value: "7"},
+		{Key: "float", Value: "1.5"},
+		{Key: "bool", Value: "true"},
+		{Key: "time", Value: "2020-01-02T03:04:05Z"},
+		{Key: "duration", Value: "1m30s"},
+		{Key: "stringer", Value: "status:open"},
+	})
+
+	_, err = NewRequest(GET, "/search").Query("map", map[string]int{}).Build()
+	c.Assert(err, check.ErrorMatches, `gohttp: query parameter "map": unsupported type map\[string\]int`)
+}
+
+func (b *BuilderTest) TestArrayStyles(c *check.C) {
+	tests := []struct {
+		style    ArrayStyle
+		expected string
+	}{
+		{ArrayRepeat, "ids=1&ids=2"},
+		{ArrayBrackets, "ids%5B%5D=1&ids%5B%5D=2"},
+		{ArrayIndex, "ids%5B0%5D=1&ids%5B1%5D=2"},
+		{ArrayComma, "ids=1%2C2"},
+		{ArrayPipe, "ids=1%7C2"},
+	}
+	for _, test := range tests {
+		request, err := NewRequest(GET, "/items").ArrayStyle(test.style).Query("ids", []int{1, 2}).Build()
+		c.Assert(err, check.IsNil)
+		c.Assert(request.paramsForRequest(), check.Equals, test.expected)
+	}
+}
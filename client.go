@@ -1,8 +1,16 @@
 package gohttp
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/cenk/backoff"
 	"github.com/meshhq/funnel"
@@ -10,20 +18,27 @@ import (
 
 // HTTP Methods
 const (
-	GET    = "GET"
-	POST   = "POST"
-	PUT    = "PUT"
-	PATCH  = "PATCH"
-	DELETE = "DELETE"
+	GET     = "GET"
+	POST    = "POST"
+	PUT     = "PUT"
+	PATCH   = "PATCH"
+	DELETE  = "DELETE"
+	HEAD    = "HEAD"
+	OPTIONS = "OPTIONS"
 )
 
+// ErrInvalidMethod is returned when a request carries a method that is not a
+// valid HTTP token, or the TRACE method, which is never sent.
+var ErrInvalidMethod = errors.New("gohttp: invalid method")
+
 // HTTP Header Constants
 const (
-	ContentType   = "Content-Type"
-	ContentLength = "Content-Length"
-	Accept        = "Accept"
-	Authorization = "Authorization"
-	UserAgent     = "User-Agent"
+	ContentType     = "Content-Type"
+	ContentLength   = "Content-Length"
+	Accept          = "Accept"
+	Authorization   = "Authorization"
+	UserAgent       = "User-Agent"
+	WWWAuthenticate = "WWW-Authenticate"
 )
 
 // Client models an HTTP client.
@@ -40,19 +55,87 @@ type Client struct {
 	BaseURL string
 
 	// Headers model the global headers to be used for all requests issued by the client.
+	//
+	// The headers of a request take precedence over the Headers of the client,
+	// unless HeaderMerge is HeaderAppend. Neither is ever modified by the
+	// execution of a request.
 	Headers http.Header
 
+	// HeaderMerge controls how the Header of a request is merged with the
+	// Headers of the client. The default replaces the values of the client.
+	HeaderMerge HeaderMerge
+
+	// HostBoundHeaders names Headers of the client carrying credentials, such
+	// as an API key, that are only sent to the host of the BaseURL. The
+	// Authorization and Cookie headers always are.
+	HostBoundHeaders []string
+
 	// BasicAuth
 	BasicAuth *BasicAuth
 
-	// RetryableStatusCodes is an array of codes that are retryable.
+	// Authenticator authenticates every attempt of the requests issued by the
+	// client to the host of its BaseURL.
+	Authenticator Authenticator
+
+	// RetryableStatusCodes is an array of codes that are retryable. It is
+	// consulted by the default retry policy when RetryPolicy is nil.
 	RetryableStatusCodes []int
 
-	// Backoff ...
+	// ReturnHTTPErrors, when true, makes responses with a non-2xx status code
+	// produce an `*HTTPError`, returned along with the response.
+	ReturnHTTPErrors bool
+
+	// ErrorDecoder optionally decodes the body of unsuccessful responses into
+	// the Body of the resulting `*HTTPError`.
+	ErrorDecoder ErrorDecoder
+
+	// Middleware wraps the execution of every request issued by the client,
+	// including rate limiting and retries. See `Middleware` for ordering.
+	Middleware []Middleware
+
+	// AttemptMiddleware wraps every single attempt of the requests issued by
+	// the client, inside the retry loop.
+	AttemptMiddleware []Middleware
+
+	// RetryPolicy decides which attempts are retried. When nil, the client
+	// uses `DefaultRetryPolicy(RetryableStatusCodes...)`.
+	RetryPolicy RetryPolicy
+
+	// Encoders encode request bodies by media type. See `Request.ContentType`.
+	Encoders Encoders
+
+	// Decoders decode response bodies by media type. See `Response.Unmarshal`.
+	Decoders Decoders
+
+	// MaxResponseSize caps the size of buffered response bodies. Larger bodies
+	// fail the request with ErrResponseTooLarge. Zero means no limit.
+	MaxResponseSize int64
+
+	// MaxRetryAfter caps the delay a server can request through the
+	// `Retry-After` or rate limit reset headers of a 429 or 503 response. A
+	// zero value disables server provided delays.
+	MaxRetryAfter time.Duration
+
+	// Backoff is the template backoff policy for requests issued by the client.
+	// Each request derives its own copy, so the template is never mutated and
+	// may be shared by concurrent requests.
 	Backoff *backoff.ExponentialBackOff
 
-	// rateLimiter is a rate limiter.
-	rateLimiter *funnel.RateLimiter
+	// RateLimiter paces the requests issued by the client. Nil disables rate
+	// limiting.
+	RateLimiter RateLimiter
+
+	// RouteLimits are additional rate limiters applied to the requests matching
+	// a host, method and path. A request waits for the client RateLimiter and
+	// for every matching route limiter, in order, before being issued.
+	RouteLimits []RouteLimit
+
+	// RateLimiterFailureMode controls whether requests are aborted (the
+	// default) or let through when the RateLimiter is unavailable.
+	RateLimiterFailureMode RateLimiterFailureMode
+
+	// RateLimiterHook, if set, is notified after every rate limiter wait.
+	RateLimiterHook RateLimiterHook
 
 	// goClient is the underlying `http.Client` that is used to issue requests.
 	goClient *http.Client
@@ -63,20 +146,43 @@ type Client struct {
 //------------------------------------------------------------------------------
 
 // NewClient instantiates a new instance of a gohttp.Client.
-func NewClient(baseURL string, headers http.Header) *Client {
+//
+// Without options, the client issues its requests through a transport with
+// the GoHTTP default timeouts and connection pooling parameters.
+func NewClient(baseURL string, headers http.Header, options ...Option) *Client {
 	if headers == nil {
 		headers = http.Header{}
 	}
 
+	opts := newClientOptions()
+	for _, option := range options {
+		option(opts)
+	}
+
 	client := new(Client)
 	client.BaseURL = baseURL
 	client.Headers = headers
-	client.goClient = &http.Client{}
+	client.goClient = opts.build()
 	client.Backoff = Backoff()
-	client.RetryableStatusCodes = []int{http.StatusRequestTimeout, 429, 500}
+	client.RetryableStatusCodes = []int{
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+	client.MaxRetryAfter = DefaultMaxRetryAfter
+	client.Encoders = DefaultEncoders()
+	client.Decoders = DefaultDecoders()
 	return client
 }
 
+// HTTPClient returns the underlying `http.Client` used to issue requests.
+func (c *Client) HTTPClient() *http.Client {
+	return c.goClient
+}
+
 //------------------------------------------------------------------------------
 // Basic Authentication
 //------------------------------------------------------------------------------
@@ -90,17 +196,67 @@ func (c *Client) SetBasicAuth(username string, password string) {
 	c.BasicAuth = basicAuth
 }
 
+//------------------------------------------------------------------------------
+// Content Negotiation
+//------------------------------------------------------------------------------
+
+// RegisterEncoder registers the encoder of a media type, such as
+// "application/vnd.api+json", replacing any existing one.
+func (c *Client) RegisterEncoder(mediaType string, encoder Encoder) {
+	if c.Encoders == nil {
+		c.Encoders = DefaultEncoders()
+	}
+	c.Encoders[strings.ToLower(mediaType)] = encoder
+}
+
+// encoders returns the encoders of the client, or the default ones.
+func (c *Client) encoders() Encoders {
+	if c.Encoders == nil {
+		return defaultEncoders
+	}
+	return c.Encoders
+}
+
+// RegisterDecoder registers the decoder of a media type, such as
+// "application/vnd.api+json", replacing any existing one.
+func (c *Client) RegisterDecoder(mediaType string, decoder Decoder) {
+	if c.Decoders == nil {
+		c.Decoders = DefaultDecoders()
+	}
+	c.Decoders[strings.ToLower(mediaType)] = decoder
+}
+
 //------------------------------------------------------------------------------
 // Rate Limiting
 //------------------------------------------------------------------------------
 
-// SetRateLimiterInfo provides..
+// SetRateLimit configures the client with an in-process rate limiter that
+// admits at most maxRequests requests per interval.
+func (c *Client) SetRateLimit(maxRequests int, interval time.Duration) {
+	c.RateLimiter = NewSlidingWindowLimiter(maxRequests, interval)
+}
+
+// SetRouteRateLimit adds an in-process rate limiter that admits at most
+// maxRequests requests per interval among the requests matching host, method
+// and the path pattern. See `RouteLimit` for the matching rules.
+func (c *Client) SetRouteRateLimit(host string, method string, pattern string, maxRequests int, interval time.Duration) {
+	c.RouteLimits = append(c.RouteLimits, RouteLimit{
+		Host:    host,
+		Method:  method,
+		Path:    pattern,
+		Limiter: NewSlidingWindowLimiter(maxRequests, interval),
+	})
+}
+
+// SetRateLimiterInfo configures the client with a distributed rate limiter
+// backed by Funnel and Redis, so the limit is shared by every process using
+// the same token.
 func (c *Client) SetRateLimiterInfo(limitInfo *funnel.RateLimitInfo) error {
-	limiter, err := funnel.NewLimiter(limitInfo)
+	limiter, err := NewFunnelLimiter(limitInfo)
 	if err != nil {
 		return err
 	}
-	c.rateLimiter = limiter
+	c.RateLimiter = limiter
 	return nil
 }
 
@@ -110,20 +266,39 @@ func (c *Client) SetRateLimiterInfo(limitInfo *funnel.RateLimitInfo) error {
 
 // Execute executes the HTTPc request described with the given `gohttp.Request`.
 func (c *Client) Execute(req *Request) (*Response, error) {
+	return c.ExecuteContext(context.Background(), req)
+}
+
+// ExecuteContext executes the HTTP request described with the given
+// `gohttp.Request`, bound to the supplied `context.Context`. Cancelling the
+// context aborts the rate limiter wait, any in-flight attempt and any pending
+// retry, in which case `ctx.Err()` is returned.
+func (c *Client) ExecuteContext(ctx context.Context, req *Request) (*Response, error) {
 	var err error
 	var response *Response
 
 	switch req.Method {
 	case GET:
-		response, err = c.Get(req)
+		response, err = c.GetContext(ctx, req)
 	case POST:
-		response, err = c.Post(req)
+		response, err = c.PostContext(ctx, req)
 	case DELETE:
-		response, err = c.Delete(req)
+		response, err = c.DeleteContext(ctx, req)
 	case PUT:
-		response, err = c.Put(req)
+		response, err = c.PutContext(ctx, req)
 	case PATCH:
-		response, err = c.Patch(req)
+		response, err = c.PatchContext(ctx, req)
+	case HEAD:
+		response, err = c.HeadContext(ctx, req)
+	case OPTIONS:
+		response, err = c.OptionsContext(ctx, req)
+	default:
+		// Any other method, such as the WebDAV ones, is executed as is as long
+		// as it is a valid token other than TRACE. An empty method means GET.
+		if !validMethod(req.Method) {
+			return nil, fmt.Errorf("%w %q", ErrInvalidMethod, req.Method)
+		}
+		response, err = c.do(ctx, req)
 	}
 
 	if response != nil {
@@ -139,108 +314,486 @@ func (c *Client) Execute(req *Request) (*Response, error) {
 
 // Get performs an HTTP GET request with the supplied request object.
 func (c *Client) Get(request *Request) (*Response, error) {
-	req, err := request.Translate(c)
-	if err != nil {
-		return nil, err
-	}
-	return c.executeRequest(req)
+	return c.GetContext(context.Background(), request)
+}
+
+// GetContext performs an HTTP GET request with the supplied request object
+// and context.
+func (c *Client) GetContext(ctx context.Context, request *Request) (*Response, error) {
+	return c.do(ctx, request)
 }
 
 // Post performs an HTTP POST request with the supplied request object.
 func (c *Client) Post(request *Request) (*Response, error) {
-	req, err := request.Translate(c)
-	if err != nil {
-		return nil, err
-	}
-	return c.executeRequest(req)
+	return c.PostContext(context.Background(), request)
+}
+
+// PostContext performs an HTTP POST request with the supplied request object
+// and context.
+func (c *Client) PostContext(ctx context.Context, request *Request) (*Response, error) {
+	return c.do(ctx, request)
 }
 
 // Delete performs an HTTP DELETE request with the supplied request object.
 func (c *Client) Delete(request *Request) (*Response, error) {
-	req, err := request.Translate(c)
-	if err != nil {
-		return nil, err
-	}
-	return c.executeRequest(req)
+	return c.DeleteContext(context.Background(), request)
+}
+
+// DeleteContext performs an HTTP DELETE request with the supplied request
+// object and context.
+func (c *Client) DeleteContext(ctx context.Context, request *Request) (*Response, error) {
+	return c.do(ctx, request)
 }
 
 // Put performs an HTTP PUT request with the supplied URL string and
 // parameters.
 func (c *Client) Put(request *Request) (*Response, error) {
-	req, err := request.Translate(c)
-	if err != nil {
-		return nil, err
-	}
-	return c.executeRequest(req)
+	return c.PutContext(context.Background(), request)
+}
+
+// PutContext performs an HTTP PUT request with the supplied request object
+// and context.
+func (c *Client) PutContext(ctx context.Context, request *Request) (*Response, error) {
+	return c.do(ctx, request)
 }
 
 // Patch performs an HTTP PATCH request with the supplied URL string and
 // parameters.
 func (c *Client) Patch(request *Request) (*Response, error) {
-	req, err := request.Translate(c)
-	if err != nil {
-		return nil, err
-	}
-	return c.executeRequest(req)
+	return c.PatchContext(context.Background(), request)
+}
+
+// PatchContext performs an HTTP PATCH request with the supplied request
+// object and context.
+func (c *Client) PatchContext(ctx context.Context, request *Request) (*Response, error) {
+	return c.do(ctx, request)
+}
+
+// Head performs an HTTP HEAD request with the supplied request object. The
+// response body is never read.
+func (c *Client) Head(request *Request) (*Response, error) {
+	return c.HeadContext(context.Background(), request)
+}
+
+// HeadContext performs an HTTP HEAD request with the supplied request object
+// and context.
+func (c *Client) HeadContext(ctx context.Context, request *Request) (*Response, error) {
+	return c.do(ctx, request)
+}
+
+// Options performs an HTTP OPTIONS request with the supplied request object.
+func (c *Client) Options(request *Request) (*Response, error) {
+	return c.OptionsContext(context.Background(), request)
+}
+
+// OptionsContext performs an HTTP OPTIONS request with the supplied request
+// object and context.
+func (c *Client) OptionsContext(ctx context.Context, request *Request) (*Response, error) {
+	return c.do(ctx, request)
 }
 
 //------------------------------------------------------------------------------
 // Request Execution
 //------------------------------------------------------------------------------
 
-func (c *Client) executeRequest(req *http.Request) (*Response, error) {
+// do translates and executes the request.
+func (c *Client) do(ctx context.Context, request *Request) (*Response, error) {
+	req, err := request.TranslateContext(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	// A middleware may call next again with a request it already sent, whose
+	// body must then be re-armed.
+	var sentMutex sync.Mutex
+	sent := map[*http.Request]bool{}
+	execute := func(req *http.Request) (*Response, error) {
+		sentMutex.Lock()
+		resend := sent[req]
+		sent[req] = true
+		sentMutex.Unlock()
+		if resend {
+			if err := rewindBody(req); err != nil {
+				return nil, err
+			}
+		}
+
+		response, err := c.executeRequest(req.Context(), request, req)
+		if response == nil || response.Code != http.StatusUnauthorized || !c.ownsHost(req.URL) {
+			return response, err
+		}
+
+		// Answer the challenge or refresh rejected credentials, and retry once.
+		switch authenticator := c.Authenticator.(type) {
+		case Challenger:
+			if authenticator.Challenge(response) != nil {
+				return response, err
+			}
+		case Refresher:
+			if authenticator.Refresh(req) != nil {
+				return response, err
+			}
+		default:
+			return response, err
+		}
+		if rewindBody(req) != nil {
+			return response, err
+		}
+		response.Close()
+		return c.executeRequest(req.Context(), request, req)
+	}
+	return chain(execute, c.Middleware, request.Middleware)(req)
+}
+
+func (c *Client) executeRequest(ctx context.Context, request *Request, req *http.Request) (*Response, error) {
 
 	var parsedError error
 	var parsedResponse *Response
 
-	// Setup our retryable operation.
+	// Each request gets its own backoff state, which may be overridden by
+	// delays requested by the server.
+	retryBackoff := &serverDelayBackOff{BackOff: newBackoff(c.Backoff, request.Backoff)}
+	retryPolicy := c.retryPolicy(request)
+
+	// Every attempt goes through the attempt middleware.
+	send := chain(func(req *http.Request) (*Response, error) {
+		return c.send(req, request.Stream)
+	}, c.AttemptMiddleware)
+
+	// Setup our retryable operation. Every attempt is recorded so that
+	// exhausted retries can be reported in detail.
+	var attempts []Attempt
+	attempt := 0
 	retry := func() error {
+		attempt++
 
-		// Execute the actual request.
-		response, err := c.goClient.Do(req)
-		if err != nil {
-			parsedError = err
-			return nil
+		// Discard the streamed body of the previous attempt and re-arm the
+		// request body, which it drained.
+		if attempt > 1 {
+			if parsedResponse != nil {
+				parsedResponse.Close()
+			}
+			if err := rewindBody(req); err != nil {
+				parsedResponse, parsedError = nil, err
+				return nil
+			}
 		}
 
-		// Defer closing response body if it exists.
-		if response != nil {
-			defer response.Body.Close()
+		// Execute the actual request.
+		parsedResponse, parsedError = send(req)
+		if parsedResponse == nil {
+			if parsedError == nil {
+				parsedError = errors.New("gohttp: middleware returned no response")
+			}
+			attempts = append(attempts, Attempt{Err: parsedError})
+			if retryPolicy.ShouldRetry(attempt, req, nil, parsedError) {
+				return parsedError
+			}
+			return nil
 		}
 
-		// Parse our response into a gohttp.Response object.
-		parsedResponse, parsedError = NewResponse(response)
+		attempts = append(attempts, Attempt{StatusCode: parsedResponse.Code, Err: parsedError})
 		if parsedError != nil {
 			return nil
 		}
 
-		// Retry status code checks.
+		// Retry policy checks.
 		//
-		// If the client encounters a retryable status code, we return
-		// an error to signal a retry should occur
-		for _, code := range c.RetryableStatusCodes {
-			if code == parsedResponse.Code {
-				return errors.New("encountered retryable status code")
-			}
+		// If the policy asks for a retry, we return an error to signal a
+		// retry should occur.
+		if retryPolicy.ShouldRetry(attempt, req, parsedResponse, nil) {
+			retryBackoff.delay = c.serverDelay(parsedResponse)
+			return fmt.Errorf("encountered retryable status code %d", parsedResponse.Code)
 		}
 		return nil
 	}
 
-	// Rate Limiter - If we are using a rate limiter, we enter here.
+	// Rate Limiter - If we are using rate limiters, we enter here.
 	//
-	// This will block until the rate limiter is satisfied.
-	if c.rateLimiter != nil {
-		err := c.rateLimiter.Enter()
-		if err != nil {
+	// This will block until every rate limiter that applies to the request is
+	// satisfied or the context is done.
+	if err := c.waitRateLimiters(ctx, c.rateLimitersFor(request, req)); err != nil {
+		return nil, err
+	}
+
+	// Execute the retryable operation. The backoff is bound to the context so
+	// that a cancellation stops any pending sleep between attempts.
+	start := time.Now()
+	err := backoff.Retry(retry, backoff.WithContext(retryBackoff, ctx))
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if parsedResponse != nil {
+			parsedResponse.Close()
+		}
+		return nil, ctxErr
+	}
+
+	// The backoff gave up while the policy still asked for a retry. Streamed
+	// bodies of failed requests are buffered, so that the error carries them.
+	if err != nil {
+		if parsedResponse != nil {
+			if err := parsedResponse.buffer(c.MaxResponseSize); err != nil {
+				return nil, err
+			}
+			parsedResponse.Request = request
+		}
+		exhausted := NewRetryExhaustedError(attempts, time.Since(start), parsedResponse, c.ErrorDecoder)
+		if parsedResponse != nil {
+			parsedResponse.Error = exhausted
+		}
+		return parsedResponse, exhausted
+	}
+
+	// Surface unsuccessful responses as errors if the client asks for it.
+	if parsedError == nil && c.ReturnHTTPErrors && !isSuccess(parsedResponse.Code) {
+		if err := parsedResponse.buffer(c.MaxResponseSize); err != nil {
+			return nil, err
+		}
+		parsedResponse.Request = request
+		parsedResponse.Error = NewHTTPError(parsedResponse, c.ErrorDecoder)
+		return parsedResponse, parsedResponse.Error
+	}
+
+	return parsedResponse, parsedError
+}
+
+// hostBoundHeaders are the Headers of a client that are never sent to another
+// host than the one of its BaseURL, as `http.Client` does on redirects.
+var hostBoundHeaders = []string{Authorization, "Www-Authenticate", "Cookie", "Cookie2"}
+
+// ownsHost reports whether u points at the host of the BaseURL of the client,
+// to which its credentials are sent. Without a BaseURL, every host is trusted.
+func (c *Client) ownsHost(u *url.URL) bool {
+	if c.BaseURL == "" {
+		return true
+	}
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return false
+	}
+	return hostPort(base) == hostPort(u)
+}
+
+// foreignHeaders returns the Headers of the client to send to another host,
+// without its host-bound headers.
+func (c *Client) foreignHeaders() http.Header {
+	headers := make(http.Header, len(c.Headers))
+	for key, values := range c.Headers {
+		headers[http.CanonicalHeaderKey(key)] = values
+	}
+	for _, names := range [][]string{hostBoundHeaders, c.HostBoundHeaders} {
+		for _, name := range names {
+			delete(headers, http.CanonicalHeaderKey(name))
+		}
+	}
+	return headers
+}
+
+// hostPort returns the lowercase host of u with its port, which defaults to
+// the port of its scheme.
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// send authenticates and issues a single attempt of the request with the
+// underlying `http.Client`, then parses the response. In streaming mode, the
+// body of the response is left unread.
+func (c *Client) send(req *http.Request, stream bool) (*Response, error) {
+	if c.Authenticator != nil && c.ownsHost(req.URL) {
+		if err := c.Authenticator.Authenticate(req); err != nil {
 			return nil, err
 		}
 	}
 
-	// Execute the retryable operation
-	err := backoff.Retry(retry, c.Backoff)
+	var response *http.Response
+	var err error
+	if stream {
+		response, err = c.doStream(req)
+	} else {
+		response, err = c.goClient.Do(req)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return parsedResponse, parsedError
+	// Parse our response into a gohttp.Response object.
+	parsedResponse := newStreamingResponse(response, c.Decoders)
+	if stream {
+		return parsedResponse, nil
+	}
+	if err := parsedResponse.buffer(c.MaxResponseSize); err != nil {
+		return nil, err
+	}
+	return parsedResponse, nil
+}
+
+// doStream issues an attempt whose body is streamed. The timeout of the
+// underlying `http.Client` only bounds the wait for the response headers, so
+// that reading a large body is not cut off.
+func (c *Client) doStream(req *http.Request) (*http.Response, error) {
+	client := *c.goClient
+	timeout := client.Timeout
+	client.Timeout = 0
+	if timeout <= 0 {
+		return client.Do(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(timeout, cancel)
+	response, err := client.Do(req.WithContext(ctx))
+	if !timer.Stop() && req.Context().Err() == nil {
+		if response != nil {
+			response.Body.Close()
+		}
+		cancel()
+		return nil, &url.Error{Op: urlErrorOp(req.Method), URL: req.URL.String(), Err: errHeaderTimeout}
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The context lives as long as the body.
+	response.Body = &cancelingBody{ReadCloser: response.Body, cancel: cancel}
+	return response, nil
+}
+
+// errHeaderTimeout reports a streamed attempt whose response headers did not
+// arrive in time. It is a timeout `net.Error`, retried like the other ones.
+var errHeaderTimeout error = headerTimeoutError{}
+
+type headerTimeoutError struct{}
+
+func (headerTimeoutError) Error() string   { return "gohttp: timeout awaiting response headers" }
+func (headerTimeoutError) Timeout() bool   { return true }
+func (headerTimeoutError) Temporary() bool { return true }
+
+// urlErrorOp returns the Op of the `*url.Error` of a request, as
+// `http.Client` does.
+func urlErrorOp(method string) string {
+	if method == "" {
+		return "Get"
+	}
+	return method[:1] + strings.ToLower(method[1:])
+}
+
+// cancelingBody cancels the context of a streamed attempt once its body is
+// closed.
+type cancelingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// retryPolicy returns the retry policy that applies to the request.
+func (c *Client) retryPolicy(request *Request) RetryPolicy {
+	if request.RetryPolicy != nil {
+		return request.RetryPolicy
+	}
+	if c.RetryPolicy != nil {
+		return c.RetryPolicy
+	}
+	return DefaultRetryPolicy(c.RetryableStatusCodes...)
+}
+
+// rateLimitersFor returns the rate limiters that apply to the request.
+func (c *Client) rateLimitersFor(request *Request, req *http.Request) []RateLimiter {
+	var limiters []RateLimiter
+	if c.RateLimiter != nil {
+		limiters = append(limiters, c.RateLimiter)
+	}
+	requestPath := request.routePath()
+	for _, route := range c.RouteLimits {
+		if route.Limiter != nil && route.Matches(req.Method, req.URL.Host, requestPath) {
+			limiters = append(limiters, route.Limiter)
+		}
+	}
+	return limiters
+}
+
+// waitRateLimiters waits for every rate limiter in turn. When one of them
+// fails, the slots already taken from the previous ones are released, so that
+// a request is admitted by all of its limiters or by none.
+func (c *Client) waitRateLimiters(ctx context.Context, limiters []RateLimiter) error {
+	var admitted []RateLimiter
+	for _, limiter := range limiters {
+		ok, err := c.waitRateLimiter(ctx, limiter)
+		if err != nil {
+			for _, previous := range admitted {
+				if releaser, ok := previous.(Releaser); ok {
+					releaser.Release()
+				}
+			}
+			return err
+		}
+		if ok {
+			admitted = append(admitted, limiter)
+		}
+	}
+	return nil
+}
+
+// waitRateLimiter waits for the rate limiter, reports the outcome to the hook
+// and applies the failure mode of the client. It returns whether the limiter
+// admitted the request, which is not the case when it failed open.
+func (c *Client) waitRateLimiter(ctx context.Context, limiter RateLimiter) (bool, error) {
+	start := time.Now()
+	err := limiter.Wait(ctx)
+	if c.RateLimiterHook != nil {
+		c.RateLimiterHook(time.Since(start), err)
+	}
+
+	var limiterErr *RateLimiterError
+	if errors.As(err, &limiterErr) && c.RateLimiterFailureMode == FailOpen {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// serverDelay returns the delay requested by the server for a throttled
+// response, capped by `MaxRetryAfter`.
+func (c *Client) serverDelay(response *Response) time.Duration {
+	if c.MaxRetryAfter <= 0 {
+		return 0
+	}
+	if response.Code != http.StatusTooManyRequests && response.Code != http.StatusServiceUnavailable {
+		return 0
+	}
+
+	delay := response.RateLimit.Delay(time.Now())
+	if delay > c.MaxRetryAfter {
+		delay = c.MaxRetryAfter
+	}
+	return delay
+}
+
+// validMethod reports whether method is empty or a valid HTTP token as
+// defined by RFC 7230. TRACE, which echoes credentials back, is rejected
+// whatever its case.
+func validMethod(method string) bool {
+	if strings.EqualFold(method, http.MethodTrace) {
+		return false
+	}
+	for _, r := range method {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+		default:
+			return false
+		}
+	}
+	return true
 }
@@ -1,10 +1,19 @@
 package gohttp
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -23,22 +32,20 @@ var _ = check.Suite(&ClientTest{})
 
 var server *httptest.Server
 
-var requestCounter = 0
+var requestCounter int32
 
-func (r *ClientTest) SetUpSuite(c *check.C) {
-	err := meshRedis.SetupRedis()
-	c.Assert(err, check.Equals, nil)
+var requestBodies []string
+
+var limitCounter int32
 
+func (r *ClientTest) SetUpSuite(c *check.C) {
 	server = httptest.NewServer(RouteRequest())
 }
 
 func (r *ClientTest) SetUpTest(c *check.C) {
-	requestCounter = 0
-}
-
-func (r *ClientTest) TearDownSuite(c *check.C) {
-	err := meshRedis.ClosePool()
-	c.Assert(err, check.Equals, nil)
+	atomic.StoreInt32(&requestCounter, 0)
+	requestBodies = nil
+	atomic.StoreInt32(&limitCounter, 0)
 }
 
 //------------------------------------------------------------------------------
@@ -74,6 +81,89 @@ func (r *ClientTest) TestBasicAuthRequest(c *check.C) {
 	c.Assert(client.BasicAuth.Password, check.Equals, password)
 }
 
+func (r *ClientTest) TestCredentialsStayOnBaseHost(c *check.C) {
+	other := httptest.NewServer(server.Config.Handler)
+	defer other.Close()
+
+	for _, configure := range []func(*Client){
+		func(client *Client) { client.SetBasicAuth("testname", "testpass") },
+		func(client *Client) { client.Authenticator = &BearerAuth{Token: "secret"} },
+		func(client *Client) { client.Headers.Set(Authorization, "Bearer secret") },
+	} {
+		client := NewClient(server.URL, http.Header{})
+		configure(client)
+
+		response, err := client.Execute(&Request{Method: GET, URL: "/echo-header/Authorization"})
+		c.Assert(err, check.IsNil)
+		c.Assert(string(response.Data), check.Not(check.Equals), "")
+
+		response, err = client.Execute(&Request{Method: GET, URL: "//echo-header/Authorization"})
+		c.Assert(err, check.IsNil)
+		c.Assert(string(response.Data), check.Not(check.Equals), "")
+
+		response, err = client.Execute(&Request{Method: GET, URL: other.URL + "/echo-header/Authorization"})
+		c.Assert(err, check.IsNil)
+		c.Assert(string(response.Data), check.Equals, "")
+	}
+
+	// Credentials set on the request itself are sent anywhere.
+	client := NewClient(server.URL, nil)
+	client.SetBasicAuth("testname", "testpass")
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    other.URL + "/echo-header/Authorization",
+		Header: http.Header{Authorization: {"Bearer mine"}},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(response.Data), check.Equals, "Bearer mine")
+}
+
+func (r *ClientTest) TestHostBoundHeaders(c *check.C) {
+	other := httptest.NewServer(server.Config.Handler)
+	defer other.Close()
+
+	client := NewClient(server.URL, http.Header{"X-Api-Key": {"secret"}, "Cookie": {"session=1"}, "X-Tag": {"client"}})
+	client.HostBoundHeaders = []string{"x-api-key"}
+	for name, expected := range map[string]string{"X-Api-Key": "secret", "Cookie": "session=1", "X-Tag": "client"} {
+		response, err := client.Execute(&Request{Method: GET, URL: "/echo-header/" + name})
+		c.Assert(err, check.IsNil)
+		c.Assert(string(response.Data), check.Equals, expected)
+
+		if name != "X-Tag" {
+			expected = ""
+		}
+		response, err = client.Execute(&Request{Method: GET, URL: other.URL + "/echo-header/" + name})
+		c.Assert(err, check.IsNil)
+		c.Assert(string(response.Data), check.Equals, expected)
+	}
+	c.Assert(client.Headers.Get("X-Api-Key"), check.Equals, "secret")
+}
+
+func (r *ClientTest) TestOwnsHostWithDefaultPorts(c *check.C) {
+	client := NewClient("https://api.example.com/v1", nil)
+	client.SetBasicAuth("testname", "testpass")
+	tests := map[string]bool{
+		"https://api.example.com/users":      true,
+		"https://API.example.com:443/users":  true,
+		"https://api.example.com:8443/users": false,
+		"http://api.example.com/users":       false,
+		"https://other.example.com/users":    false,
+	}
+	for rawURL, owned := range tests {
+		u, err := url.Parse(rawURL)
+		c.Assert(err, check.IsNil)
+		c.Assert(client.ownsHost(u), check.Equals, owned, check.Commentf(rawURL))
+
+		translated, err := (&Request{Method: GET, URL: rawURL}).Translate(client)
+		c.Assert(err, check.IsNil)
+		c.Assert(translated.Header.Get(Authorization) != "", check.Equals, owned, check.Commentf(rawURL))
+	}
+
+	client.BaseURL = "http://[::1]:80/v1"
+	u, _ := url.Parse("http://[::1]/users")
+	c.Assert(client.ownsHost(u), check.Equals, true)
+}
+
 //------------------------------------------------------------------------------
 // GET Request
 //------------------------------------------------------------------------------
@@ -209,6 +299,198 @@ func (r *ClientTest) TestDeleteRequest(c *check.C) {
 	c.Assert(response.Code, check.Equals, http.StatusNoContent)
 }
 
+//------------------------------------------------------------------------------
+// HEAD Request
+//------------------------------------------------------------------------------
+
+func (r *ClientTest) TestHeadRequest(c *check.C) {
+	client := NewClient(server.URL, nil)
+	response, err := client.Execute(&Request{
+		Method: HEAD,
+		URL:    "/test",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(response.Header.Get(ContentLength), check.Equals, "42")
+	c.Assert(response.Data, check.HasLen, 0)
+}
+
+//------------------------------------------------------------------------------
+// OPTIONS Request
+//------------------------------------------------------------------------------
+
+func (r *ClientTest) TestOptionsRequest(c *check.C) {
+	client := NewClient(server.URL, nil)
+	response, err := client.Options(&Request{
+		Method: OPTIONS,
+		URL:    "/test",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusNoContent)
+	c.Assert(response.Header.Get("Allow"), check.Not(check.Equals), "")
+}
+
+//------------------------------------------------------------------------------
+// Custom Methods
+//------------------------------------------------------------------------------
+
+func (r *ClientTest) TestCustomMethodRequest(c *check.C) {
+	client := NewClient(server.URL, nil)
+	response, err := client.Execute(&Request{
+		Method: "PROPFIND",
+		URL:    "/test",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusMultiStatus)
+}
+
+func (r *ClientTest) TestInvalidMethodRequest(c *check.C) {
+	client := NewClient(server.URL, nil)
+	response, err := client.Execute(&Request{
+		Method: "BAD METHOD",
+		URL:    "/test",
+	})
+	c.Assert(errors.Is(err, ErrInvalidMethod), check.Equals, true)
+	c.Assert(response, check.IsNil)
+}
+
+func (r *ClientTest) TestTraceRequestIsRejected(c *check.C) {
+	client := NewClient(server.URL, nil)
+	for _, method := range []string{"TRACE", "trace", "Trace"} {
+		response, err := client.Execute(&Request{
+			Method: method,
+			URL:    "/test",
+		})
+		c.Assert(errors.Is(err, ErrInvalidMethod), check.Equals, true)
+		c.Assert(response, check.IsNil)
+	}
+}
+
+//------------------------------------------------------------------------------
+// Middleware
+//------------------------------------------------------------------------------
+
+func (r *ClientTest) TestMiddlewareModifiesRequestAndResponse(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.Middleware = []Middleware{func(next Handler) Handler {
+		return func(req *http.Request) (*Response, error) {
+			req.Header.Set("X-Trace-Id", "trace")
+			response, err := next(req)
+			if response != nil {
+				response.Header.Set("X-Observed", "true")
+			}
+			return response, err
+		}
+	}}
+
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/echo-header/X-Trace-Id",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(response.Data), check.Equals, "trace")
+	c.Assert(response.Header.Get("X-Observed"), check.Equals, "true")
+}
+
+func (r *ClientTest) TestMiddlewareShortCircuits(c *check.C) {
+	client := NewClient(server.URL, nil)
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/limit",
+		Middleware: []Middleware{func(next Handler) Handler {
+			return func(req *http.Request) (*Response, error) {
+				return &Response{Code: http.StatusNotModified}, nil
+			}
+		}},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusNotModified)
+	c.Assert(atomic.LoadInt32(&limitCounter), check.Equals, int32(0))
+}
+
+func (r *ClientTest) TestMiddlewareWrapsRetries(c *check.C) {
+	var trace []string
+	client := NewClient(server.URL, nil)
+	client.RetryableStatusCodes = []int{500}
+	client.Middleware = []Middleware{recordingMiddleware("request", &trace)}
+	client.AttemptMiddleware = []Middleware{recordingMiddleware("attempt", &trace)}
+
+	_, err := client.Execute(&Request{
+		Method:  GET,
+		URL:     "/retry",
+		Backoff: &BackoffOptions{MaxAttempts: 2},
+	})
+	c.Assert(err, check.NotNil)
+	c.Assert(trace, check.DeepEquals, []string{
+		"request before",
+		"attempt before",
+		"attempt after",
+		"attempt before",
+		"attempt after",
+		"request after",
+	})
+}
+
+//------------------------------------------------------------------------------
+// HTTP Errors
+//------------------------------------------------------------------------------
+
+func (r *ClientTest) TestNonSuccessStatusWithoutHTTPErrors(c *check.C) {
+	client := NewClient(server.URL, nil)
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/status/404",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusNotFound)
+	c.Assert(response.Error, check.IsNil)
+}
+
+func (r *ClientTest) TestNonSuccessStatusWithHTTPErrors(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.ReturnHTTPErrors = true
+	request := &Request{
+		Method: GET,
+		URL:    "/status/404",
+	}
+	response, err := client.Execute(request)
+	c.Assert(IsClientError(err), check.Equals, true)
+	c.Assert(IsStatus(err, http.StatusNotFound), check.Equals, true)
+	c.Assert(response.Code, check.Equals, http.StatusNotFound)
+	c.Assert(response.Error, check.Equals, err)
+
+	httpErr := err.(*HTTPError)
+	c.Assert(httpErr.Request, check.Equals, request)
+	c.Assert(httpErr.Body, check.DeepEquals, map[string]interface{}{"message": "status 404"})
+	c.Assert(httpErr.Header.Get(ContentType), check.Equals, "application/json")
+}
+
+func (r *ClientTest) TestNonSuccessStatusWithErrorDecoder(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.ReturnHTTPErrors = true
+	client.ErrorDecoder = func(response *Response) (interface{}, error) {
+		envelope := map[string]string{}
+		err := response.Unmarshal(&envelope)
+		return envelope["message"], err
+	}
+	_, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/status/400",
+	})
+	c.Assert(err.(*HTTPError).Body, check.Equals, "status 400")
+}
+
+func (r *ClientTest) TestSuccessStatusWithHTTPErrors(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.ReturnHTTPErrors = true
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/status/202",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusAccepted)
+}
+
 //------------------------------------------------------------------------------
 // Retry
 //------------------------------------------------------------------------------
@@ -221,14 +503,475 @@ func (r *ClientTest) TestRetryScenario(c *check.C) {
 		URL:    "/retry",
 	})
 	c.Assert(err, check.NotNil)
-	c.Assert(requestCounter > 1, check.Equals, true)
+	c.Assert(atomic.LoadInt32(&requestCounter) > 1, check.Equals, true)
+}
+
+func (r *ClientTest) TestRetryWithMaxAttempts(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.RetryableStatusCodes = []int{500}
+	_, err := client.Execute(&Request{
+		Method:  GET,
+		URL:     "/retry",
+		Backoff: &BackoffOptions{MaxAttempts: 3},
+	})
+	c.Assert(err, check.NotNil)
+	c.Assert(atomic.LoadInt32(&requestCounter), check.Equals, int32(3))
+}
+
+func (r *ClientTest) TestRetryReplaysJSONBody(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.RetryableStatusCodes = []int{500}
+	response, err := client.Execute(&Request{
+		Method: POST,
+		URL:    "/replay",
+		Body:   map[string]interface{}{"name": "test"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(requestBodies, check.DeepEquals, []string{`{"name":"test"}`, `{"name":"test"}`, `{"name":"test"}`})
+}
+
+func (r *ClientTest) TestRetryReplaysFormBody(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.RetryableStatusCodes = []int{500}
+	response, err := client.Execute(&Request{
+		Method: PUT,
+		URL:    "/replay",
+		Form:   map[string]interface{}{"name": "test"},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(requestBodies, check.DeepEquals, []string{"name=test", "name=test", "name=test"})
+}
+
+func (r *ClientTest) TestRetryReplaysReaderBody(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.RetryableStatusCodes = []int{500}
+	response, err := client.Execute(&Request{
+		Method: PATCH,
+		URL:    "/replay",
+		Body:   ioutil.NopCloser(bytes.NewBufferString("raw payload")),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(requestBodies, check.DeepEquals, []string{"raw payload", "raw payload", "raw payload"})
+}
+
+func (r *ClientTest) TestRetryHonorsRetryAfter(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.Backoff.InitialInterval = time.Millisecond
+
+	start := time.Now()
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/throttle",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(atomic.LoadInt32(&requestCounter), check.Equals, int32(2))
+	c.Assert(time.Since(start) >= time.Second, check.Equals, true)
+}
+
+func (r *ClientTest) TestRetryCapsRetryAfter(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.Backoff.InitialInterval = time.Millisecond
+	client.MaxRetryAfter = 10 * time.Millisecond
+
+	start := time.Now()
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/throttle",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(time.Since(start) < time.Second, check.Equals, true)
+}
+
+func (r *ClientTest) TestRetryHonorsRetryAfterOnServiceUnavailable(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.Backoff.InitialInterval = time.Millisecond
+	client.MaxRetryAfter = 10 * time.Millisecond
+
+	start := time.Now()
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/throttle",
+		Params: []Param{{Key: "code", Value: "503"}, {Key: "after", Value: "9999999999999"}},
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(atomic.LoadInt32(&requestCounter), check.Equals, int32(2))
+	c.Assert(time.Since(start) < time.Second, check.Equals, true)
+}
+
+func (r *ClientTest) TestRetryExhausted(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.RetryableStatusCodes = []int{500}
+	request := &Request{
+		Method:  GET,
+		URL:     "/retry",
+		Backoff: &BackoffOptions{MaxAttempts: 3},
+	}
+	response, err := client.Execute(request)
+
+	exhausted, ok := err.(*RetryExhaustedError)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(exhausted.Attempts, check.DeepEquals, []Attempt{{StatusCode: 500}, {StatusCode: 500}, {StatusCode: 500}})
+	c.Assert(exhausted.Elapsed > 0, check.Equals, true)
+	c.Assert(exhausted.Response, check.Equals, response)
+	c.Assert(response.Code, check.Equals, http.StatusInternalServerError)
+	c.Assert(response.Request, check.Equals, request)
+	c.Assert(IsServerError(err), check.Equals, true)
+}
+
+func (r *ClientTest) TestRetryExhaustedWithErrorDecoder(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.RetryableStatusCodes = []int{503}
+	client.ErrorDecoder = func(response *Response) (interface{}, error) {
+		envelope := map[string]string{}
+		err := response.Unmarshal(&envelope)
+		return envelope["message"], err
+	}
+	_, err := client.Execute(&Request{
+		Method:  GET,
+		URL:     "/status/503",
+		Backoff: &BackoffOptions{MaxAttempts: 2},
+	})
+
+	var httpErr *HTTPError
+	c.Assert(errors.As(err, &httpErr), check.Equals, true)
+	c.Assert(httpErr.Body, check.Equals, "status 503")
+}
+
+func (r *ClientTest) TestRetryWithRequestPolicy(c *check.C) {
+	client := NewClient(server.URL, nil)
+	response, err := client.Execute(&Request{
+		Method:      GET,
+		URL:         "/retry",
+		RetryPolicy: RetryOnStatusCodes(),
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusInternalServerError)
+	c.Assert(atomic.LoadInt32(&requestCounter), check.Equals, int32(1))
+}
+
+func (r *ClientTest) TestRetryOnNetworkError(c *check.C) {
+	client := NewClient(server.URL, nil)
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/hangup",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+}
+
+func (r *ClientTest) TestNoRetryOnNetworkErrorForPost(c *check.C) {
+	client := NewClient(server.URL, nil)
+	_, err := client.Execute(&Request{
+		Method: POST,
+		URL:    "/hangup",
+	})
+	c.Assert(err, check.NotNil)
+	c.Assert(atomic.LoadInt32(&requestCounter), check.Equals, int32(1))
 }
 
 //------------------------------------------------------------------------------
-// Retry
+// Streaming
+//------------------------------------------------------------------------------
+
+func (r *ClientTest) TestStreamingResponse(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.MaxResponseSize = 16
+	response, err := client.Execute(&Request{Method: GET, URL: "/download", Stream: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(response.Data, check.IsNil)
+	c.Assert(response.Stream, check.NotNil)
+
+	data, err := ioutil.ReadAll(response.Stream)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, downloadPayload)
+	c.Assert(response.Close(), check.IsNil)
+	c.Assert(response.Stream, check.IsNil)
+}
+
+func (r *ClientTest) TestStreamingOutlivesTimeout(c *check.C) {
+	client := NewClient(server.URL, nil, WithTimeout(100*time.Millisecond))
+	request := &Request{Method: GET, URL: "/trickle", Stream: true, Backoff: &BackoffOptions{MaxAttempts: 1}}
+
+	response, err := client.Execute(request)
+	c.Assert(err, check.IsNil)
+	data, err := ioutil.ReadAll(response.Stream)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, strings.Repeat("chunk", 10))
+	c.Assert(response.Close(), check.IsNil)
+
+	// Buffered responses are still bounded by the timeout.
+	request.Stream = false
+	_, err = client.Execute(request)
+	c.Assert(err, check.NotNil)
+}
+
+func (r *ClientTest) TestStreamingHeaderTimeout(c *check.C) {
+	client := NewClient(server.URL, nil, WithTimeout(50*time.Millisecond))
+	_, err := client.Execute(&Request{
+		Method:  GET,
+		URL:     "/trickle",
+		Params:  []Param{{Key: "wait", Value: "300ms"}},
+		Stream:  true,
+		Backoff: &BackoffOptions{MaxAttempts: 1},
+	})
+	var netErr net.Error
+	c.Assert(errors.As(err, &netErr), check.Equals, true)
+	c.Assert(netErr.Timeout(), check.Equals, true)
+}
+
+func (r *ClientTest) TestStreamingRetriesBeforeHandoff(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.RetryableStatusCodes = []int{500}
+	response, err := client.Execute(&Request{Method: GET, URL: "/download?failures=2", Stream: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&requestCounter), check.Equals, int32(3))
+	defer response.Close()
+
+	data, err := ioutil.ReadAll(response.Stream)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, downloadPayload)
+}
+
+func (r *ClientTest) TestStreamingBuffersFailedResponse(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.RetryableStatusCodes = []int{500}
+	response, err := client.Execute(&Request{
+		Method:  GET,
+		URL:     "/download?failures=5",
+		Stream:  true,
+		Backoff: &BackoffOptions{MaxAttempts: 2},
+	})
+	c.Assert(err, check.NotNil)
+	c.Assert(response.Stream, check.IsNil)
+	c.Assert(string(response.Data), check.Equals, "failure")
+}
+
+func (r *ClientTest) TestStreamingFailedResponseTooLarge(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.MaxResponseSize = 4
+	client.RetryableStatusCodes = []int{500}
+	_, err := client.Execute(&Request{
+		Method:  GET,
+		URL:     "/download?failures=5",
+		Stream:  true,
+		Backoff: &BackoffOptions{MaxAttempts: 2},
+	})
+	c.Assert(err, check.Equals, ErrResponseTooLarge)
+
+	atomic.StoreInt32(&requestCounter, 0)
+	client.RetryableStatusCodes = []int{}
+	client.ReturnHTTPErrors = true
+	_, err = client.Execute(&Request{Method: GET, URL: "/download?failures=1", Stream: true})
+	c.Assert(err, check.Equals, ErrResponseTooLarge)
+}
+
+func (r *ClientTest) TestMaxResponseSize(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.MaxResponseSize = int64(len(downloadPayload))
+	response, err := client.Execute(&Request{Method: GET, URL: "/download"})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(response.Data), check.Equals, downloadPayload)
+
+	client.MaxResponseSize--
+	_, err = client.Execute(&Request{Method: GET, URL: "/download"})
+	c.Assert(err, check.Equals, ErrResponseTooLarge)
+}
+
+//------------------------------------------------------------------------------
+// Context
+//------------------------------------------------------------------------------
+
+func (r *ClientTest) TestExecuteContextCanceled(c *check.C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := NewClient(server.URL, nil)
+	response, err := client.ExecuteContext(ctx, &Request{
+		Method: GET,
+		URL:    "/test",
+	})
+	c.Assert(err, check.Equals, context.Canceled)
+	c.Assert(response, check.IsNil)
+}
+
+func (r *ClientTest) TestExecuteContextDeadlineDuringRequest(c *check.C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	client := NewClient(server.URL, nil)
+	_, err := client.ExecuteContext(ctx, &Request{
+		Method: GET,
+		URL:    "/slow",
+	})
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+}
+
+func (r *ClientTest) TestExecuteContextDeadlineDuringRetry(c *check.C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	client := NewClient(server.URL, nil)
+	client.RetryableStatusCodes = []int{500}
+
+	start := time.Now()
+	_, err := client.ExecuteContext(ctx, &Request{
+		Method: GET,
+		URL:    "/retry",
+	})
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+	c.Assert(time.Since(start) < DefaultMaxElapsedTime, check.Equals, true)
+}
+
+//------------------------------------------------------------------------------
+// Rate Limiting
 //------------------------------------------------------------------------------
 
 func (r *ClientTest) TestRateLimitingClient(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.SetRateLimit(10, time.Second) // 10 requests per second
+
+	// Pending requests are abandoned at the end of the test.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Execute 100 Requests
+	for i := 0; i < 100; i++ {
+		go func() {
+			response, err := client.ExecuteContext(ctx, &Request{
+				Method: GET,
+				URL:    "/limit",
+			})
+			if err == context.Canceled {
+				return
+			}
+			c.Assert(err, check.IsNil)
+			c.Assert(response.Code, check.Equals, http.StatusOK)
+		}()
+	}
+	time.Sleep(500 * time.Millisecond)
+	c.Assert(atomic.LoadInt32(&limitCounter), check.Equals, int32(10))
+
+	time.Sleep(1 * time.Second)
+	c.Assert(atomic.LoadInt32(&limitCounter), check.Equals, int32(20))
+}
+
+func (r *ClientTest) TestRouteRateLimitingClient(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.SetRouteRateLimit("", GET, "/limit", 2, time.Hour)
+	client.SetRouteRateLimit("", POST, "/limit", 1, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		_, err := client.ExecuteContext(ctx, &Request{
+			Method: GET,
+			URL:    "/limit",
+		})
+		if i < 2 {
+			c.Assert(err, check.IsNil)
+		} else {
+			c.Assert(err, check.Equals, context.DeadlineExceeded)
+		}
+	}
+
+	// Each route has its own budget.
+	_, err := client.Execute(&Request{
+		Method: POST,
+		URL:    "/limit",
+	})
+	c.Assert(err, check.IsNil)
+
+	// Requests that match no route limit are not throttled.
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/test",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(atomic.LoadInt32(&limitCounter), check.Equals, int32(3))
+}
+
+func (r *ClientTest) TestRouteRateLimitingMatchesRequestURL(c *check.C) {
+	client := NewClient(server.URL+"/v1", nil)
+	client.SetRouteRateLimit("", GET, "/users/*", 1, time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err := client.ExecuteContext(ctx, &Request{Method: GET, URL: "users/1"})
+	c.Assert(err, check.IsNil)
+	_, err = client.ExecuteContext(ctx, &Request{Method: GET, URL: "/users/2"})
+	c.Assert(err, check.Equals, context.DeadlineExceeded)
+}
+
+func (r *ClientTest) TestRateLimitersAdmitAllOrNone(c *check.C) {
+	client := NewClient(server.URL, nil)
+	client.SetRouteRateLimit("", GET, "/limit", 1, time.Hour)
+	client.RouteLimits = append(client.RouteLimits, RouteLimit{Path: "/limit", Limiter: unavailableLimiter{}})
+
+	_, err := client.Execute(&Request{Method: GET, URL: "/limit"})
+	_, ok := err.(*RateLimiterError)
+	c.Assert(ok, check.Equals, true)
+
+	// The slot taken from the first limiter was given back.
+	client.RouteLimits = client.RouteLimits[:1]
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.ExecuteContext(ctx, &Request{Method: GET, URL: "/limit"})
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&limitCounter), check.Equals, int32(1))
+}
+
+func (r *ClientTest) TestRateLimiterFailClosed(c *check.C) {
+	var hookErr error
+	client := NewClient(server.URL, nil)
+	client.RateLimiter = unavailableLimiter{}
+	client.RateLimiterHook = func(wait time.Duration, err error) {
+		hookErr = err
+	}
+
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/test",
+	})
+	_, ok := err.(*RateLimiterError)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(response, check.IsNil)
+	c.Assert(hookErr, check.Equals, err)
+}
+
+func (r *ClientTest) TestRateLimiterFailOpen(c *check.C) {
+	var hookErr error
+	client := NewClient(server.URL, nil)
+	client.RateLimiter = unavailableLimiter{}
+	client.RateLimiterFailureMode = FailOpen
+	client.RateLimiterHook = func(wait time.Duration, err error) {
+		hookErr = err
+	}
+
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/test",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(hookErr, check.NotNil)
+}
+
+func (r *ClientTest) TestDistributedRateLimitingClient(c *check.C) {
+	if err := meshRedis.SetupRedis(); err != nil {
+		c.Skip("redis is not available")
+	}
+	defer meshRedis.ClosePool()
+
 	client := NewClient(server.URL, nil)
 	err := client.SetRateLimiterInfo(&funnel.RateLimitInfo{
 		Token:        fmt.Sprintf("%v", time.Now()),
@@ -249,10 +992,20 @@ func (r *ClientTest) TestRateLimitingClient(c *check.C) {
 		}()
 	}
 	time.Sleep(1 * time.Second)
-	c.Assert(requestCounter, check.Equals, 10)
+	c.Assert(atomic.LoadInt32(&limitCounter), check.Equals, int32(10))
 
 	time.Sleep(1 * time.Second)
-	c.Assert(requestCounter, check.Equals, 20)
+	c.Assert(atomic.LoadInt32(&limitCounter), check.Equals, int32(20))
+}
+
+//------------------------------------------------------------------------------
+// Test Rate Limiter
+//------------------------------------------------------------------------------
+
+type unavailableLimiter struct{}
+
+func (l unavailableLimiter) Wait(ctx context.Context) error {
+	return &RateLimiterError{Err: errors.New("connection refused")}
 }
 
 //------------------------------------------------------------------------------
@@ -265,6 +1018,14 @@ func RouteRequest() http.Handler {
 	mux.HandleFunc("/json", HandleJSON)
 	mux.HandleFunc("/retry", HandleRetry)
 	mux.HandleFunc("/limit", HandleLimit)
+	mux.HandleFunc("/slow", HandleSlow)
+	mux.HandleFunc("/replay", HandleReplay)
+	mux.HandleFunc("/throttle", HandleThrottle)
+	mux.HandleFunc("/hangup", HandleHangup)
+	mux.HandleFunc("/status/{code}", HandleStatus)
+	mux.HandleFunc("/echo-header/{name}", HandleEchoHeader)
+	mux.HandleFunc("/download", HandleDownload)
+	mux.HandleFunc("/trickle", HandleTrickle)
 	return mux
 }
 
@@ -278,6 +1039,17 @@ func HandleTest(w http.ResponseWriter, r *http.Request) {
 
 	case PUT, PATCH, DELETE:
 		w.WriteHeader(http.StatusNoContent)
+
+	case HEAD:
+		w.Header().Set(ContentLength, "42")
+		w.WriteHeader(http.StatusOK)
+
+	case OPTIONS:
+		w.Header().Set("Allow", "GET, POST, PUT, PATCH, DELETE, HEAD, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+
+	case "PROPFIND":
+		w.WriteHeader(http.StatusMultiStatus)
 	}
 }
 
@@ -289,11 +1061,106 @@ func HandleJSON(w http.ResponseWriter, r *http.Request) {
 }
 
 func HandleRetry(w http.ResponseWriter, r *http.Request) {
-	requestCounter++
+	atomic.AddInt32(&requestCounter, 1)
 	w.WriteHeader(http.StatusInternalServerError)
 }
 
 func HandleLimit(w http.ResponseWriter, r *http.Request) {
-	requestCounter++
+	atomic.AddInt32(&limitCounter, 1)
 	w.WriteHeader(http.StatusOK)
 }
+
+func HandleSlow(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(time.Second):
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func HandleReplay(w http.ResponseWriter, r *http.Request) {
+	attempt := atomic.AddInt32(&requestCounter, 1)
+	body, _ := ioutil.ReadAll(r.Body)
+	requestBodies = append(requestBodies, string(body))
+	if attempt < 3 {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func HandleThrottle(w http.ResponseWriter, r *http.Request) {
+	if atomic.AddInt32(&requestCounter, 1) == 1 {
+		code, err := strconv.Atoi(r.URL.Query().Get("code"))
+		if err != nil {
+			code = http.StatusTooManyRequests
+		}
+		after := r.URL.Query().Get("after")
+		if after == "" {
+			after = "1"
+		}
+		w.Header().Set(RetryAfter, after)
+		w.WriteHeader(code)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func HandleHangup(w http.ResponseWriter, r *http.Request) {
+	if atomic.AddInt32(&requestCounter, 1) <= 2 {
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func HandleStatus(w http.ResponseWriter, r *http.Request) {
+	code, _ := strconv.Atoi(mux.Vars(r)["code"])
+	responseData, _ := json.Marshal(map[string]interface{}{"message": fmt.Sprintf("status %d", code)})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(responseData)
+}
+
+func HandleEchoHeader(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(r.Header.Get(mux.Vars(r)["name"])))
+}
+
+// downloadPayload is the body served by HandleDownload.
+var downloadPayload = strings.Repeat("0123456789abcdef", 4096)
+
+func HandleDownload(w http.ResponseWriter, r *http.Request) {
+	attempt := atomic.AddInt32(&requestCounter, 1)
+	failures, _ := strconv.Atoi(r.URL.Query().Get("failures"))
+	if int(attempt) <= failures {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("failure"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(downloadPayload))
+}
+
+// HandleTrickle waits for the "wait" duration, then sends ten chunks 30
+// milliseconds apart.
+func HandleTrickle(w http.ResponseWriter, r *http.Request) {
+	wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+	select {
+	case <-r.Context().Done():
+		return
+	case <-time.After(wait):
+	}
+
+	w.WriteHeader(http.StatusOK)
+	for i := 0; i < 10; i++ {
+		w.Write([]byte("chunk"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(30 * time.Millisecond):
+		}
+	}
+}
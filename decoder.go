@@ -0,0 +1,489 @@
+package gohttp
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/url"
+	"strings"
+
+	"github.com/ajg/form"
+)
+
+// Media Types
+const (
+	MediaTypeJSON        = "application/json"
+	MediaTypeXML         = "application/xml"
+	MediaTypeTextXML     = "text/xml"
+	MediaTypeForm        = "application/x-www-form-urlencoded"
+	MediaTypeText        = "text/plain"
+	MediaTypeMsgpack     = "application/msgpack"
+	MediaTypeXMsgpack    = "application/x-msgpack"
+	MediaTypeProtobuf    = "application/protobuf"
+	MediaTypeXProtobuf   = "application/x-protobuf"
+	MediaTypeOctetStream = "application/octet-stream"
+)
+
+// ErrUnsupportedMediaType is returned when no encoder is registered for the
+// media type of a request body, or no decoder for the media type of a
+// response.
+var ErrUnsupportedMediaType = errors.New("gohttp: unsupported media type")
+
+// ErrUnsupportedTarget is returned by a decoder that cannot decode into the
+// given value. When populating the Body of a response, it leaves Body nil.
+var ErrUnsupportedTarget = errors.New("gohttp: unsupported decoding target")
+
+//------------------------------------------------------------------------------
+// Decoders
+//------------------------------------------------------------------------------
+
+// Decoder decodes response bodies of a media type.
+//
+// Decode is called with a pointer to an empty interface to populate the Body
+// of a response, and with the value passed to `Response.Unmarshal`.
+type Decoder interface {
+	Decode(data []byte, v interface{}) error
+}
+
+// DecoderFunc adapts a function to the Decoder interface.
+type DecoderFunc func(data []byte, v interface{}) error
+
+// Decode calls f(data, v).
+func (f DecoderFunc) Decode(data []byte, v interface{}) error {
+	return f(data, v)
+}
+
+// Decoders maps media types, such as "application/json", to decoders.
+type Decoders map[string]Decoder
+
+// DefaultDecoders returns the decoders for JSON, XML, form-urlencoded, plain
+// text, msgpack and protobuf payloads.
+func DefaultDecoders() Decoders {
+	return Decoders{
+		MediaTypeJSON:      JSONDecoder,
+		MediaTypeXML:       XMLDecoder,
+		MediaTypeTextXML:   XMLDecoder,
+		MediaTypeForm:      FormDecoder,
+		MediaTypeText:      TextDecoder,
+		MediaTypeMsgpack:   MsgpackDecoder,
+		MediaTypeXMsgpack:  MsgpackDecoder,
+		MediaTypeProtobuf:  ProtobufDecoder,
+		MediaTypeXProtobuf: ProtobufDecoder,
+	}
+}
+
+// defaultDecoders are used by responses built without a client.
+var defaultDecoders = DefaultDecoders()
+
+// Lookup returns the decoder of a `Content-Type` header value. Structured
+// syntax suffixes are honored, so "application/problem+json" is decoded as
+// JSON unless a decoder is registered for it.
+func (d Decoders) Lookup(contentType string) (Decoder, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	if decoder, ok := d[mediaType]; ok {
+		return decoder, true
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		decoder, ok := d["application/"+mediaType[i+1:]]
+		return decoder, ok
+	}
+	return nil, false
+}
+
+//------------------------------------------------------------------------------
+// Built-in Decoders
+//------------------------------------------------------------------------------
+
+// JSONDecoder decodes JSON payloads. Untyped values keep their numbers as
+// `json.Number`, like `ParseJSON`.
+var JSONDecoder Decoder = jsonDecoder{}
+
+type jsonDecoder struct{}
+
+func (jsonDecoder) Decode(data []byte, v interface{}) error {
+	if body, ok := v.(*interface{}); ok {
+		value, err := ParseJSON(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		*body = value
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// XMLDecoder decodes XML payloads. Untyped values are decoded into a
+// `map[string]interface{}` keyed by the name of the root element, in which
+// attributes are prefixed by "-", repeated elements are collected in slices
+// and the text of elements with attributes or children is keyed by "#text".
+var XMLDecoder Decoder = xmlDecoder{}
+
+type xmlDecoder struct{}
+
+func (xmlDecoder) Decode(data []byte, v interface{}) error {
+	if body, ok := v.(*interface{}); ok {
+		value, err := parseXML(data)
+		if err != nil {
+			return err
+		}
+		*body = value
+		return nil
+	}
+	return xml.Unmarshal(data, v)
+}
+
+// FormDecoder decodes form-urlencoded payloads. Untyped values are decoded as
+// `url.Values`, other values with `github.com/ajg/form`.
+var FormDecoder Decoder = formDecoder{}
+
+type formDecoder struct{}
+
+func (formDecoder) Decode(data []byte, v interface{}) error {
+	switch target := v.(type) {
+	case *interface{}:
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return err
+		}
+		*target = values
+		return nil
+	case *url.Values:
+		values, err := url.ParseQuery(string(data))
+		if err != nil {
+			return err
+		}
+		*target = values
+		return nil
+	}
+	return form.DecodeString(v, string(data))
+}
+
+// TextDecoder decodes plain text payloads into strings, byte slices and
+// `encoding.TextUnmarshaler` values.
+var TextDecoder Decoder = textDecoder{}
+
+type textDecoder struct{}
+
+func (textDecoder) Decode(data []byte, v interface{}) error {
+	switch target := v.(type) {
+	case *interface{}:
+		*target = string(data)
+	case *string:
+		*target = string(data)
+	case *[]byte:
+		*target = append([]byte(nil), data...)
+	case encoding.TextUnmarshaler:
+		return target.UnmarshalText(data)
+	default:
+		return ErrUnsupportedTarget
+	}
+	return nil
+}
+
+// MsgpackDecoder decodes MessagePack payloads. Values implementing
+// `UnmarshalMsg([]byte) ([]byte, error)`, as generated by msgp, decode
+// themselves. Untyped values are decoded like their JSON counterparts, with
+// maps keyed by strings and integers as int64 unless they overflow it, and
+// other values through their JSON representation.
+var MsgpackDecoder Decoder = msgpackDecoder{}
+
+type msgpackDecoder struct{}
+
+func (msgpackDecoder) Decode(data []byte, v interface{}) error {
+	if target, ok := v.(interface {
+		UnmarshalMsg([]byte) ([]byte, error)
+	}); ok {
+		_, err := target.UnmarshalMsg(data)
+		return err
+	}
+
+	value, err := parseMsgpack(data)
+	if err != nil {
+		return err
+	}
+	if body, ok := v.(*interface{}); ok {
+		*body = value
+		return nil
+	}
+
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonData, v)
+}
+
+// ProtobufDecoder decodes protocol buffer payloads into generated messages
+// implementing `Unmarshal([]byte) error`. Protocol buffers are not self
+// describing, so untyped values are not supported.
+var ProtobufDecoder Decoder = protobufDecoder{}
+
+type protobufDecoder struct{}
+
+func (protobufDecoder) Decode(data []byte, v interface{}) error {
+	target, ok := v.(interface {
+		Unmarshal([]byte) error
+	})
+	if !ok {
+		return ErrUnsupportedTarget
+	}
+	return target.Unmarshal(data)
+}
+
+//------------------------------------------------------------------------------
+// XML
+//------------------------------------------------------------------------------
+
+// parseXML decodes an XML document into nested maps.
+func parseXML(data []byte) (interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			value, err := parseXMLElement(decoder, start)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{start.Name.Local: value}, nil
+		}
+	}
+}
+
+func parseXMLElement(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	element := map[string]interface{}{}
+	for _, attr := range start.Attr {
+		element["-"+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			child, err := parseXMLElement(decoder, token)
+			if err != nil {
+				return nil, err
+			}
+			name := token.Name.Local
+			switch existing := element[name].(type) {
+			case nil:
+				element[name] = child
+			case []interface{}:
+				element[name] = append(existing, child)
+			default:
+				element[name] = []interface{}{existing, child}
+			}
+
+		case xml.CharData:
+			text.Write(token)
+
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if len(element) == 0 {
+				return content, nil
+			}
+			if content != "" {
+				element["#text"] = content
+			}
+			return element, nil
+		}
+	}
+}
+
+//------------------------------------------------------------------------------
+// MessagePack
+//------------------------------------------------------------------------------
+
+// parseMsgpack decodes a single MessagePack value.
+func parseMsgpack(data []byte) (interface{}, error) {
+	parser := &msgpackParser{data: data}
+	value, err := parser.value()
+	if err != nil {
+		return nil, err
+	}
+	if parser.offset != len(data) {
+		return nil, fmt.Errorf("gohttp: msgpack: %d trailing bytes", len(data)-parser.offset)
+	}
+	return value, nil
+}
+
+// msgpackParser reads MessagePack values from a buffer.
+type msgpackParser struct {
+	data   []byte
+	offset int
+}
+
+func (p *msgpackParser) next(n int) ([]byte, error) {
+	if n < 0 || len(p.data)-p.offset < n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := p.data[p.offset : p.offset+n]
+	p.offset += n
+	return b, nil
+}
+
+// uint reads a big endian unsigned integer of n bytes.
+func (p *msgpackParser) uint(n int) (uint64, error) {
+	b, err := p.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func (p *msgpackParser) value() (interface{}, error) {
+	b, err := p.next(1)
+	if err != nil {
+		return nil, err
+	}
+
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return p.mapValue(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return p.arrayValue(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return p.stringValue(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := p.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		data, err := p.next(int(n))
+		return append([]byte(nil), data...), err
+	case 0xca:
+		u, err := p.uint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := p.uint(8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := p.uint(1 << (c - 0xcc))
+		if u > math.MaxInt64 {
+			return u, err
+		}
+		return int64(u), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := p.uint(size)
+		shift := uint(64 - 8*size)
+		return int64(u<<shift) >> shift, err
+	case 0xd9, 0xda, 0xdb:
+		n, err := p.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return p.stringValue(int(n))
+	case 0xdc, 0xdd:
+		n, err := p.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return p.arrayValue(int(n))
+	case 0xde, 0xdf:
+		n, err := p.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return p.mapValue(int(n))
+	}
+	return nil, fmt.Errorf("gohttp: msgpack: unsupported type 0x%02x", c)
+}
+
+func (p *msgpackParser) stringValue(n int) (interface{}, error) {
+	b, err := p.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (p *msgpackParser) arrayValue(n int) (interface{}, error) {
+	if n > len(p.data)-p.offset {
+		return nil, io.ErrUnexpectedEOF
+	}
+	array := make([]interface{}, n)
+	for i := range array {
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		array[i] = value
+	}
+	return array, nil
+}
+
+// mapValue decodes a map, keyed by strings unless some key is not a string.
+func (p *msgpackParser) mapValue(n int) (interface{}, error) {
+	if n > len(p.data)-p.offset {
+		return nil, io.ErrUnexpectedEOF
+	}
+	keys := make([]interface{}, n)
+	values := make([]interface{}, n)
+	stringKeys := true
+	for i := 0; i < n; i++ {
+		key, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case string:
+		case []byte, []interface{}, map[string]interface{}, map[interface{}]interface{}:
+			return nil, errors.New("gohttp: msgpack: unsupported map key")
+		default:
+			stringKeys = false
+		}
+		keys[i], values[i] = key, value
+	}
+
+	if stringKeys {
+		m := make(map[string]interface{}, n)
+		for i, key := range keys {
+			m[key.(string)] = values[i]
+		}
+		return m, nil
+	}
+	m := make(map[interface{}]interface{}, n)
+	for i, key := range keys {
+		m[key] = values[i]
+	}
+	return m, nil
+}
@@ -0,0 +1,190 @@
+package gohttp
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"gopkg.in/check.v1"
+)
+
+type DecoderTest struct{}
+
+var _ = check.Suite(&DecoderTest{})
+
+type decodedUser struct {
+	Name  string   `json:"name" xml:"name" form:"name"`
+	Age   int      `json:"age" xml:"age" form:"age"`
+	Roles []string `json:"roles" xml:"role" form:"roles"`
+}
+
+// protobufMessage mimics a generated protocol buffer message.
+type protobufMessage struct {
+	data []byte
+}
+
+func (m *protobufMessage) Unmarshal(data []byte) error {
+	m.data = data
+	return nil
+}
+
+// msgpackUser is a MessagePack encoding of {"name":"test","age":42,"roles":["admin","dev"]}.
+var msgpackUser = []byte{
+	0x83,
+	0xa4, 'n', 'a', 'm', 'e', 0xa4, 't', 'e', 's', 't',
+	0xa3, 'a', 'g', 'e', 0x2a,
+	0xa5, 'r', 'o', 'l', 'e', 's', 0x92, 0xa5, 'a', 'd', 'm', 'i', 'n', 0xa3, 'd', 'e', 'v',
+}
+
+func (d *DecoderTest) TestLookup(c *check.C) {
+	decoders := DefaultDecoders()
+	for _, contentType := range []string{"application/json", "application/json; charset=utf-8", "Application/JSON", "application/problem+json"} {
+		decoder, ok := decoders.Lookup(contentType)
+		c.Assert(ok, check.Equals, true, check.Commentf(contentType))
+		c.Assert(decoder, check.Equals, JSONDecoder)
+	}
+
+	decoder, ok := decoders.Lookup("application/atom+xml")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(decoder, check.Equals, XMLDecoder)
+
+	_, ok = decoders.Lookup("application/octet-stream")
+	c.Assert(ok, check.Equals, false)
+	_, ok = decoders.Lookup("")
+	c.Assert(ok, check.Equals, false)
+}
+
+func (d *DecoderTest) TestJSONDecoder(c *check.C) {
+	var body interface{}
+	c.Assert(JSONDecoder.Decode([]byte(`{"age":42}`), &body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{"age": json.Number("42")})
+
+	var user decodedUser
+	c.Assert(JSONDecoder.Decode([]byte(`{"name":"test","age":42}`), &user), check.IsNil)
+	c.Assert(user, check.DeepEquals, decodedUser{Name: "test", Age: 42})
+}
+
+func (d *DecoderTest) TestXMLDecoder(c *check.C) {
+	data := []byte(`<user id="7"><name>test</name><age>42</age><role>admin</role><role>dev</role></user>`)
+
+	var body interface{}
+	c.Assert(XMLDecoder.Decode(data, &body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"user": map[string]interface{}{
+			"-id":  "7",
+			"name": "test",
+			"age":  "42",
+			"role": []interface{}{"admin", "dev"},
+		},
+	})
+
+	var user decodedUser
+	c.Assert(XMLDecoder.Decode(data, &user), check.IsNil)
+	c.Assert(user, check.DeepEquals, decodedUser{Name: "test", Age: 42, Roles: []string{"admin", "dev"}})
+}
+
+func (d *DecoderTest) TestFormDecoder(c *check.C) {
+	data := []byte("name=test&age=42")
+
+	var body interface{}
+	c.Assert(FormDecoder.Decode(data, &body), check.IsNil)
+	c.Assert(body, check.DeepEquals, url.Values{"name": {"test"}, "age": {"42"}})
+
+	var user decodedUser
+	c.Assert(FormDecoder.Decode(data, &user), check.IsNil)
+	c.Assert(user.Name, check.Equals, "test")
+	c.Assert(user.Age, check.Equals, 42)
+}
+
+func (d *DecoderTest) TestTextDecoder(c *check.C) {
+	var body interface{}
+	c.Assert(TextDecoder.Decode([]byte("hello"), &body), check.IsNil)
+	c.Assert(body, check.Equals, "hello")
+
+	var text string
+	c.Assert(TextDecoder.Decode([]byte("hello"), &text), check.IsNil)
+	c.Assert(text, check.Equals, "hello")
+
+	var user decodedUser
+	c.Assert(TextDecoder.Decode([]byte("hello"), &user), check.Equals, ErrUnsupportedTarget)
+}
+
+func (d *DecoderTest) TestMsgpackDecoder(c *check.C) {
+	var body interface{}
+	c.Assert(MsgpackDecoder.Decode(msgpackUser, &body), check.IsNil)
+	c.Assert(body, check.DeepEquals, map[string]interface{}{
+		"name":  "test",
+		"age":   int64(42),
+		"roles": []interface{}{"admin", "dev"},
+	})
+
+	var user decodedUser
+	c.Assert(MsgpackDecoder.Decode(msgpackUser, &user), check.IsNil)
+	c.Assert(user, check.DeepEquals, decodedUser{Name: "test", Age: 42, Roles: []string{"admin", "dev"}})
+
+	c.Assert(MsgpackDecoder.Decode(msgpackUser[:10], &body), check.NotNil)
+}
+
+func (d *DecoderTest) TestMsgpackScalars(c *check.C) {
+	values := map[string]interface{}{
+		"\xc0":                                 nil,
+		"\xc3":                                 true,
+		"\xff":                                 int64(-1),
+		"\xcd\x01\x00":                         int64(256),
+		"\xcf\xff\xff\xff\xff\xff\xff\xff\xff": uint64(math.MaxUint64),
+		"\xd1\xff\x00":                         int64(-256),
+		"\xcb\x3f\xf8\x00\x00\x00\x00\x00\x00": 1.5,
+		"\xc4\x02ab":                           []byte("ab"),
+	}
+	for data, expected := range values {
+		value, err := parseMsgpack([]byte(data))
+		c.Assert(err, check.IsNil)
+		c.Assert(value, check.DeepEquals, expected)
+	}
+}
+
+func (d *DecoderTest) TestProtobufDecoder(c *check.C) {
+	var message protobufMessage
+	c.Assert(ProtobufDecoder.Decode([]byte{0x08, 0x2a}, &message), check.IsNil)
+	c.Assert(message.data, check.DeepEquals, []byte{0x08, 0x2a})
+
+	var body interface{}
+	c.Assert(ProtobufDecoder.Decode([]byte{0x08, 0x2a}, &body), check.Equals, ErrUnsupportedTarget)
+}
+
+func (d *DecoderTest) TestClientRegisterDecoder(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ContentType, "application/vnd.test")
+		w.Write([]byte("a,b,c"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, nil)
+	response, err := client.Execute(&Request{Method: GET})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Body, check.IsNil)
+	c.Assert(response.Unmarshal(&[]string{}), check.Equals, ErrUnsupportedMediaType)
+
+	client.RegisterDecoder("application/vnd.test", DecoderFunc(func(data []byte, v interface{}) error {
+		fields := strings.Split(string(data), ",")
+		switch target := v.(type) {
+		case *interface{}:
+			*target = fields
+		case *[]string:
+			*target = fields
+		default:
+			return ErrUnsupportedTarget
+		}
+		return nil
+	}))
+	response, err = client.Execute(&Request{Method: GET})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Body, check.DeepEquals, []string{"a", "b", "c"})
+
+	var fields []string
+	c.Assert(response.Unmarshal(&fields), check.IsNil)
+	c.Assert(fields, check.DeepEquals, []string{"a", "b", "c"})
+}
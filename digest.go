@@ -0,0 +1,241 @@
+package gohttp
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupportedChallenge is returned when a 401 response carries no digest
+// challenge that DigestAuth can answer.
+var ErrUnsupportedChallenge = errors.New("gohttp: unsupported digest challenge")
+
+//------------------------------------------------------------------------------
+// Digest Authentication
+//------------------------------------------------------------------------------
+
+// DigestAuth authenticates requests with HTTP Digest authentication, as
+// specified by RFC 7616. The MD5 and SHA-256 algorithms, and their session
+// variants, are supported with the "auth" quality of protection.
+//
+// The first request is sent without credentials. The challenge of the server
+// is then cached, so that following requests are authenticated up front with
+// an incremented nonce count until the server issues a new nonce.
+type DigestAuth struct {
+
+	// Username for digest authentication.
+	Username string
+	// Password for digest authentication.
+	Password string
+
+	// mutex guards challenge.
+	mutex     sync.Mutex
+	challenge *digestChallenge
+}
+
+// digestChallenge models a digest challenge and its nonce count.
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	userhash  bool
+	count     uint32
+}
+
+// Authenticate sets the digest credentials on the request, once a challenge
+// was received.
+func (a *DigestAuth) Authenticate(req *http.Request) error {
+	a.mutex.Lock()
+	if a.challenge == nil {
+		a.mutex.Unlock()
+		return nil
+	}
+	a.challenge.count++
+	challenge := *a.challenge
+	a.mutex.Unlock()
+
+	cnonce, err := newCnonce()
+	if err != nil {
+		return err
+	}
+	req.Header.Set(Authorization, challenge.authorization(a.Username, a.Password, req.Method, req.URL.RequestURI(), cnonce))
+	return nil
+}
+
+// Challenge caches the digest challenge of a 401 response, preferring SHA-256
+// over MD5 when the server offers both.
+func (a *DigestAuth) Challenge(resp *Response) error {
+	var selected *digestChallenge
+	for _, header := range resp.Header.Values(WWWAuthenticate) {
+		challenge, ok := parseDigestChallenge(header)
+		if !ok {
+			continue
+		}
+		if selected == nil || strings.HasPrefix(challenge.algorithm, "SHA-256") {
+			selected = challenge
+		}
+	}
+	if selected == nil {
+		return ErrUnsupportedChallenge
+	}
+
+	a.mutex.Lock()
+	a.challenge = selected
+	a.mutex.Unlock()
+	return nil
+}
+
+// authorization computes the value of the `Authorization` header.
+func (d *digestChallenge) authorization(username string, password string, method string, uri string, cnonce string) string {
+	h := d.hash
+	nc := fmt.Sprintf("%08x", d.count)
+
+	ha1 := h(username + ":" + d.realm + ":" + password)
+	if strings.HasSuffix(d.algorithm, "-sess") {
+		ha1 = h(ha1 + ":" + d.nonce + ":" + cnonce)
+	}
+	ha2 := h(method + ":" + uri)
+
+	var response string
+	if d.qop == "" {
+		response = h(ha1 + ":" + d.nonce + ":" + ha2)
+	} else {
+		response = h(strings.Join([]string{ha1, d.nonce, nc, cnonce, d.qop, ha2}, ":"))
+	}
+
+	if d.userhash {
+		username = h(username + ":" + d.realm)
+	}
+	params := []string{
+		fmt.Sprintf("username=%q", username),
+		fmt.Sprintf("realm=%q", d.realm),
+		fmt.Sprintf("uri=%q", uri),
+		fmt.Sprintf("algorithm=%s", d.algorithm),
+		fmt.Sprintf("nonce=%q", d.nonce),
+	}
+	if d.qop != "" {
+		params = append(params, "nc="+nc, fmt.Sprintf("cnonce=%q", cnonce), "qop="+d.qop)
+	}
+	params = append(params, fmt.Sprintf("response=%q", response))
+	if d.opaque != "" {
+		params = append(params, fmt.Sprintf("opaque=%q", d.opaque))
+	}
+	if d.userhash {
+		params = append(params, "userhash=true")
+	}
+	return "Digest " + strings.Join(params, ", ")
+}
+
+func (d *digestChallenge) hash(data string) string {
+	var h hash.Hash
+	if strings.HasPrefix(d.algorithm, "SHA-256") {
+		h = sha256.New()
+	} else {
+		h = md5.New()
+	}
+	h.Write([]byte(data))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// parseDigestChallenge parses a digest challenge. The challenge is rejected
+// if its algorithm is not supported or if it does not offer the "auth"
+// quality of protection.
+func parseDigestChallenge(header string) (*digestChallenge, bool) {
+	scheme, rest := strings.TrimSpace(header), ""
+	if i := strings.IndexByte(scheme, ' '); i >= 0 {
+		scheme, rest = scheme[:i], scheme[i+1:]
+	}
+	if !strings.EqualFold(scheme, "Digest") {
+		return nil, false
+	}
+
+	params := parseAuthParams(rest)
+	challenge := &digestChallenge{
+		realm:     params["realm"],
+		nonce:     params["nonce"],
+		opaque:    params["opaque"],
+		algorithm: strings.ToUpper(params["algorithm"]),
+		userhash:  strings.EqualFold(params["userhash"], "true"),
+	}
+	if challenge.algorithm == "" {
+		challenge.algorithm = "MD5"
+	}
+	switch challenge.algorithm {
+	case "MD5", "MD5-SESS", "SHA-256", "SHA-256-SESS":
+		challenge.algorithm = strings.Replace(challenge.algorithm, "-SESS", "-sess", 1)
+	default:
+		return nil, false
+	}
+
+	if qop, ok := params["qop"]; ok {
+		for _, option := range strings.Split(qop, ",") {
+			if strings.TrimSpace(option) == "auth" {
+				challenge.qop = "auth"
+			}
+		}
+		if challenge.qop == "" {
+			return nil, false
+		}
+	}
+	return challenge, challenge.nonce != ""
+}
+
+// parseAuthParams parses the comma separated, possibly quoted, parameters of
+// an authentication challenge.
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return params
+		}
+
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var value strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i < len(s) {
+				// Skip the closing quote.
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(strings.TrimSpace(s[:end]))
+			s = s[end:]
+		}
+		params[key] = value.String()
+	}
+}
+
+func newCnonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
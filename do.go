@@ -0,0 +1,140 @@
+package gohttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// DecodeOption configures the decoding of responses by `Do`.
+type DecodeOption func(*decodeOptions)
+
+// decodeOptions holds the configuration of `Do`.
+type decodeOptions struct {
+	strict       bool
+	errorDecoder ErrorDecoder
+}
+
+// Strict rejects JSON bodies with fields unknown to the target type, or with
+// trailing data after the JSON value.
+func Strict() DecodeOption {
+	return func(o *decodeOptions) {
+		o.strict = true
+	}
+}
+
+// WithErrorDecoder decodes the body of unsuccessful responses with decoder
+// instead of the ErrorDecoder of the client.
+func WithErrorDecoder(decoder ErrorDecoder) DecodeOption {
+	return func(o *decodeOptions) {
+		o.errorDecoder = decoder
+	}
+}
+
+// DecodeErrorAs returns an ErrorDecoder decoding unsuccessful responses into a
+// *E, such as the error envelope of an API. It can be set as the ErrorDecoder
+// of a client or passed to `Do` with WithErrorDecoder.
+func DecodeErrorAs[E any]() ErrorDecoder {
+	return func(response *Response) (interface{}, error) {
+		target := new(E)
+		if err := decodeInto(response, target, false); err != nil {
+			return nil, err
+		}
+		return target, nil
+	}
+}
+
+//------------------------------------------------------------------------------
+// Typed Execution
+//------------------------------------------------------------------------------
+
+// Do executes the request with the client and decodes the body of a successful
+// response into a T, with the decoder matching its `Content-Type`. JSON bodies
+// are decoded like `ParseJSON`, so numbers held by interface{} values are
+// decoded as `json.Number`.
+//
+// A response with a non-2xx status code is returned with an `*HTTPError`,
+// whether or not the client has ReturnHTTPErrors enabled, and its body is
+// decoded by the ErrorDecoder of the client or the one set with
+// WithErrorDecoder. A successful response without a body yields the zero T.
+//
+// Streamed responses are decoded straight from their Stream, which is closed.
+func Do[T any](ctx context.Context, client *Client, request *Request, options ...DecodeOption) (T, *Response, error) {
+	var result T
+
+	opts := &decodeOptions{errorDecoder: client.ErrorDecoder}
+	for _, option := range options {
+		option(opts)
+	}
+
+	response, err := client.ExecuteContext(ctx, request)
+	if err != nil {
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && opts.errorDecoder != nil {
+			if body, decodeErr := opts.errorDecoder(httpErr.Response); decodeErr == nil {
+				httpErr.Body = body
+			}
+		}
+		return result, response, err
+	}
+
+	if !isSuccess(response.Code) {
+		if err := response.buffer(client.MaxResponseSize); err != nil {
+			return result, response, err
+		}
+		response.Error = NewHTTPError(response, opts.errorDecoder)
+		return result, response, response.Error
+	}
+
+	if err := decodeInto(response, &result, opts.strict); err != nil {
+		return result, response, err
+	}
+	return result, response, nil
+}
+
+// decodeInto decodes the body of a response into v. JSON is decoded with
+// numbers as `json.Number`, and other media types with the decoder of the
+// response.
+func decodeInto(response *Response, v interface{}, strict bool) error {
+	defer response.Close()
+
+	contentType := response.Header.Get(ContentType)
+	decoder, ok := response.decoder()
+	if contentType != "" && !ok {
+		return ErrUnsupportedMediaType
+	}
+	if contentType != "" && decoder != JSONDecoder {
+		if err := response.buffer(0); err != nil {
+			return err
+		}
+		if len(response.Data) == 0 {
+			return nil
+		}
+		return decoder.Decode(response.Data, v)
+	}
+
+	var reader io.Reader = bytes.NewReader(response.Data)
+	if response.Stream != nil {
+		reader = response.Stream
+	}
+
+	jsonDecoder := json.NewDecoder(reader)
+	jsonDecoder.UseNumber()
+	if strict {
+		jsonDecoder.DisallowUnknownFields()
+	}
+	if err := jsonDecoder.Decode(v); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+	if strict {
+		if _, err := jsonDecoder.Token(); err != io.EOF {
+			return errors.New("gohttp: unexpected data after the JSON body")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package gohttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"gopkg.in/check.v1"
+)
+
+type DoTest struct {
+	server *httptest.Server
+}
+
+var _ = check.Suite(&DoTest{})
+
+type doUser struct {
+	Name  string      `json:"name" xml:"name"`
+	Age   int         `json:"age" xml:"age"`
+	Extra interface{} `json:"extra,omitempty" xml:"-"`
+}
+
+type doAPIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (d *DoTest) SetUpSuite(c *check.C) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ContentType, "application/json")
+		w.Write([]byte(`{"name":"test","age":42,"extra":12345678901234567890}`))
+	})
+	mux.HandleFunc("/unknown", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ContentType, "application/json")
+		w.Write([]byte(`{"name":"test","unknown":true}`))
+	})
+	mux.HandleFunc("/xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ContentType, "application/xml")
+		w.Write([]byte(`<user><name>test</name><age>42</age></user>`))
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(ContentType, "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"code":"not_found","message":"no such user"}`))
+	})
+	d.server = httptest.NewServer(mux)
+}
+
+func (d *DoTest) TearDownSuite(c *check.C) {
+	d.server.Close()
+}
+
+func (d *DoTest) TestDoDecodesJSON(c *check.C) {
+	client := NewClient(d.server.URL, nil)
+	user, response, err := Do[doUser](context.Background(), client, &Request{Method: GET, URL: "/user"})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(user.Name, check.Equals, "test")
+	c.Assert(user.Age, check.Equals, 42)
+	c.Assert(user.Extra, check.Equals, json.Number("12345678901234567890"))
+}
+
+func (d *DoTest) TestDoDecodesPointersAndMaps(c *check.C) {
+	client := NewClient(d.server.URL, nil)
+	user, _, err := Do[*doUser](context.Background(), client, &Request{Method: GET, URL: "/user"})
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Name, check.Equals, "test")
+
+	body, _, err := Do[map[string]interface{}](context.Background(), client, &Request{Method: GET, URL: "/user"})
+	c.Assert(err, check.IsNil)
+	c.Assert(body["age"], check.Equals, json.Number("42"))
+}
+
+func (d *DoTest) TestDoDecodesStream(c *check.C) {
+	client := NewClient(d.server.URL, nil)
+	user, response, err := Do[doUser](context.Background(), client, &Request{Method: GET, URL: "/user", Stream: true})
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Name, check.Equals, "test")
+	c.Assert(response.Stream, check.IsNil)
+}
+
+func (d *DoTest) TestDoDecodesByContentType(c *check.C) {
+	client := NewClient(d.server.URL, nil)
+	user, _, err := Do[doUser](context.Background(), client, &Request{Method: GET, URL: "/xml"})
+	c.Assert(err, check.IsNil)
+	c.Assert(user, check.DeepEquals, doUser{Name: "test", Age: 42})
+}
+
+func (d *DoTest) TestDoWithoutBody(c *check.C) {
+	client := NewClient(d.server.URL, nil)
+	user, response, err := Do[doUser](context.Background(), client, &Request{Method: GET, URL: "/empty"})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusNoContent)
+	c.Assert(user, check.DeepEquals, doUser{})
+}
+
+func (d *DoTest) TestDoStrict(c *check.C) {
+	client := NewClient(d.server.URL, nil)
+	user, _, err := Do[doUser](context.Background(), client, &Request{Method: GET, URL: "/unknown"})
+	c.Assert(err, check.IsNil)
+	c.Assert(user.Name, check.Equals, "test")
+
+	_, _, err = Do[doUser](context.Background(), client, &Request{Method: GET, URL: "/unknown"}, Strict())
+	c.Assert(err, check.ErrorMatches, `json: unknown field "unknown"`)
+}
+
+func (d *DoTest) TestDoReturnsHTTPError(c *check.C) {
+	client := NewClient(d.server.URL, nil)
+	_, response, err := Do[doUser](context.Background(), client, &Request{Method: GET, URL: "/missing"}, WithErrorDecoder(DecodeErrorAs[doAPIError]()))
+	c.Assert(response.Code, check.Equals, http.StatusNotFound)
+	c.Assert(errors.Is(err, ErrClientError), check.Equals, true)
+
+	var httpErr *HTTPError
+	c.Assert(errors.As(err, &httpErr), check.Equals, true)
+	c.Assert(httpErr.Body, check.DeepEquals, &doAPIError{Code: "not_found", Message: "no such user"})
+}
+
+func (d *DoTest) TestDoUsesClientErrorDecoder(c *check.C) {
+	client := NewClient(d.server.URL, nil)
+	client.ReturnHTTPErrors = true
+	client.ErrorDecoder = DecodeErrorAs[doAPIError]()
+	_, _, err := Do[doUser](context.Background(), client, &Request{Method: GET, URL: "/missing"})
+
+	var httpErr *HTTPError
+	c.Assert(errors.As(err, &httpErr), check.Equals, true)
+	c.Assert(httpErr.Body.(*doAPIError).Code, check.Equals, "not_found")
+}
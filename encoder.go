@@ -0,0 +1,309 @@
+package gohttp
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"mime"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/ajg/form"
+)
+
+//------------------------------------------------------------------------------
+// Encoders
+//------------------------------------------------------------------------------
+
+// Encoder encodes request bodies into a media type.
+type Encoder interface {
+	Encode(v interface{}) ([]byte, error)
+}
+
+// EncoderFunc adapts a function to the Encoder interface.
+type EncoderFunc func(v interface{}) ([]byte, error)
+
+// Encode calls f(v).
+func (f EncoderFunc) Encode(v interface{}) ([]byte, error) {
+	return f(v)
+}
+
+// Encoders maps media types, such as "application/json", to encoders.
+type Encoders map[string]Encoder
+
+// DefaultEncoders returns the encoders for JSON, XML, form-urlencoded, plain
+// text, msgpack, protobuf and raw payloads.
+func DefaultEncoders() Encoders {
+	return Encoders{
+		MediaTypeJSON:        JSONEncoder,
+		MediaTypeXML:         XMLEncoder,
+		MediaTypeTextXML:     XMLEncoder,
+		MediaTypeForm:        FormEncoder,
+		MediaTypeText:        TextEncoder,
+		MediaTypeMsgpack:     MsgpackEncoder,
+		MediaTypeXMsgpack:    MsgpackEncoder,
+		MediaTypeProtobuf:    ProtobufEncoder,
+		MediaTypeXProtobuf:   ProtobufEncoder,
+		MediaTypeOctetStream: RawEncoder,
+	}
+}
+
+// defaultEncoders are used by clients without encoders.
+var defaultEncoders = DefaultEncoders()
+
+// Lookup returns the encoder of a `Content-Type` header value. Structured
+// syntax suffixes are honored, so "application/merge-patch+json" is encoded
+// as JSON unless an encoder is registered for it.
+func (e Encoders) Lookup(contentType string) (Encoder, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	if encoder, ok := e[mediaType]; ok {
+		return encoder, true
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		encoder, ok := e["application/"+mediaType[i+1:]]
+		return encoder, ok
+	}
+	return nil, false
+}
+
+//------------------------------------------------------------------------------
+// Built-in Encoders
+//------------------------------------------------------------------------------
+
+// JSONEncoder encodes values as JSON.
+var JSONEncoder Encoder = jsonEncoder{}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// XMLEncoder encodes values as XML.
+var XMLEncoder Encoder = xmlEncoder{}
+
+type xmlEncoder struct{}
+
+func (xmlEncoder) Encode(v interface{}) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+// FormEncoder encodes `url.Values` and string maps as is, and other values
+// with `github.com/ajg/form`.
+var FormEncoder Encoder = formEncoder{}
+
+type formEncoder struct{}
+
+func (formEncoder) Encode(v interface{}) ([]byte, error) {
+	switch values := v.(type) {
+	case url.Values:
+		return []byte(values.Encode()), nil
+	case map[string][]string:
+		return []byte(url.Values(values).Encode()), nil
+	case map[string]string:
+		form := url.Values{}
+		for key, value := range values {
+			form.Set(key, value)
+		}
+		return []byte(form.Encode()), nil
+	}
+
+	values, err := form.EncodeToValues(v)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(values.Encode()), nil
+}
+
+// TextEncoder encodes strings, byte slices, `encoding.TextMarshaler` and
+// `fmt.Stringer` values as plain text.
+var TextEncoder Encoder = textEncoder{}
+
+type textEncoder struct{}
+
+func (textEncoder) Encode(v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case string:
+		return []byte(value), nil
+	case []byte:
+		return value, nil
+	case encoding.TextMarshaler:
+		return value.MarshalText()
+	case fmt.Stringer:
+		return []byte(value.String()), nil
+	}
+	return nil, fmt.Errorf("gohttp: cannot encode %T as text", v)
+}
+
+// RawEncoder sends byte slices and strings as is.
+var RawEncoder Encoder = rawEncoder{}
+
+type rawEncoder struct{}
+
+func (rawEncoder) Encode(v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case []byte:
+		return value, nil
+	case string:
+		return []byte(value), nil
+	}
+	return nil, fmt.Errorf("gohttp: cannot encode %T as raw bytes", v)
+}
+
+// MsgpackEncoder encodes values as MessagePack. Values implementing
+// `MarshalMsg([]byte) ([]byte, error)`, as generated by msgp, encode
+// themselves. Other values are encoded from their JSON representation.
+var MsgpackEncoder Encoder = msgpackEncoder{}
+
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) Encode(v interface{}) ([]byte, error) {
+	if value, ok := v.(interface {
+		MarshalMsg([]byte) ([]byte, error)
+	}); ok {
+		return value.MarshalMsg(nil)
+	}
+
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	value, err := ParseJSON(bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	writeMsgpack(&buffer, value)
+	return buffer.Bytes(), nil
+}
+
+// ProtobufEncoder encodes generated protocol buffer messages implementing
+// `Marshal() ([]byte, error)`.
+var ProtobufEncoder Encoder = protobufEncoder{}
+
+type protobufEncoder struct{}
+
+func (protobufEncoder) Encode(v interface{}) ([]byte, error) {
+	message, ok := v.(interface {
+		Marshal() ([]byte, error)
+	})
+	if !ok {
+		return nil, fmt.Errorf("gohttp: cannot encode %T as protobuf", v)
+	}
+	return message.Marshal()
+}
+
+//------------------------------------------------------------------------------
+// MessagePack
+//------------------------------------------------------------------------------
+
+// writeMsgpack encodes a value decoded by `ParseJSON`. Map keys are sorted so
+// the encoding is deterministic.
+func writeMsgpack(buffer *bytes.Buffer, value interface{}) {
+	switch value := value.(type) {
+	case nil:
+		buffer.WriteByte(0xc0)
+
+	case bool:
+		if value {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+
+	case json.Number:
+		if i, err := value.Int64(); err == nil {
+			writeMsgpackInt(buffer, i)
+			return
+		}
+		f, _ := value.Float64()
+		buffer.WriteByte(0xcb)
+		writeMsgpackUint(buffer, math.Float64bits(f), 8)
+
+	case string:
+		writeMsgpackHeader(buffer, len(value), 0xa0, 31, 0xd9)
+		buffer.WriteString(value)
+
+	case []interface{}:
+		writeMsgpackHeader(buffer, len(value), 0x90, 15, 0xdc)
+		for _, item := range value {
+			writeMsgpack(buffer, item)
+		}
+
+	case map[string]interface{}:
+		writeMsgpackHeader(buffer, len(value), 0x80, 15, 0xde)
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			writeMsgpack(buffer, key)
+			writeMsgpack(buffer, value[key])
+		}
+	}
+}
+
+// writeMsgpackHeader writes the type and length of a string, array or map,
+// in its fixed form when length is at most fixMax. Strings also have an 8 bit
+// length form, at code; arrays and maps start at 16 bits.
+func writeMsgpackHeader(buffer *bytes.Buffer, length int, fixCode byte, fixMax int, code byte) {
+	switch {
+	case length <= fixMax:
+		buffer.WriteByte(fixCode | byte(length))
+	case code == 0xd9 && length <= math.MaxUint8:
+		buffer.WriteByte(code)
+		writeMsgpackUint(buffer, uint64(length), 1)
+	case length <= math.MaxUint16:
+		if code == 0xd9 {
+			code++
+		}
+		buffer.WriteByte(code)
+		writeMsgpackUint(buffer, uint64(length), 2)
+	default:
+		if code == 0xd9 {
+			code++
+		}
+		buffer.WriteByte(code + 1)
+		writeMsgpackUint(buffer, uint64(length), 4)
+	}
+}
+
+// writeMsgpackInt writes an integer in its most compact form.
+func writeMsgpackInt(buffer *bytes.Buffer, i int64) {
+	switch {
+	case i >= 0 && i <= 0x7f, i < 0 && i >= -32:
+		buffer.WriteByte(byte(i))
+		return
+	case i > 0:
+		for n, code := 1, byte(0xcc); n <= 8; n, code = n*2, code+1 {
+			if n == 8 || uint64(i) < 1<<(8*uint(n)) {
+				buffer.WriteByte(code)
+				writeMsgpackUint(buffer, uint64(i), n)
+				return
+			}
+		}
+	}
+	for n, code := 1, byte(0xd0); n <= 8; n, code = n*2, code+1 {
+		if n == 8 || i >= -1<<(8*uint(n)-1) {
+			buffer.WriteByte(code)
+			writeMsgpackUint(buffer, uint64(i), n)
+			return
+		}
+	}
+}
+
+// writeMsgpackUint writes the n low bytes of u in big endian order.
+func writeMsgpackUint(buffer *bytes.Buffer, u uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		buffer.WriteByte(byte(u >> (8 * uint(i))))
+	}
+}
@@ -0,0 +1,96 @@
+package gohttp
+
+import (
+	"math"
+	"net/url"
+
+	"gopkg.in/check.v1"
+)
+
+type EncoderTest struct{}
+
+var _ = check.Suite(&EncoderTest{})
+
+// protobufPayload mimics a generated protocol buffer message.
+type protobufPayload struct{}
+
+func (protobufPayload) Marshal() ([]byte, error) {
+	return []byte{0x08, 0x2a}, nil
+}
+
+func (e *EncoderTest) TestLookup(c *check.C) {
+	encoders := DefaultEncoders()
+	encoder, ok := encoders.Lookup("application/merge-patch+json; charset=utf-8")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(encoder, check.Equals, JSONEncoder)
+
+	_, ok = encoders.Lookup("image/png")
+	c.Assert(ok, check.Equals, false)
+}
+
+func (e *EncoderTest) TestXMLEncoder(c *check.C) {
+	data, err := XMLEncoder.Encode(decodedUser{Name: "test", Age: 42})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "<decodedUser><name>test</name><age>42</age></decodedUser>")
+}
+
+func (e *EncoderTest) TestFormEncoder(c *check.C) {
+	data, err := FormEncoder.Encode(url.Values{"b": {"2"}, "a": {"1"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "a=1&b=2")
+
+	data, err = FormEncoder.Encode(map[string]string{"name": "test"})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "name=test")
+
+	data, err = FormEncoder.Encode(map[string]interface{}{"name": "test"})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "name=test")
+}
+
+func (e *EncoderTest) TestTextAndRawEncoders(c *check.C) {
+	data, err := TextEncoder.Encode("hello")
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "hello")
+
+	_, err = TextEncoder.Encode(42)
+	c.Assert(err, check.NotNil)
+
+	data, err = RawEncoder.Encode([]byte{0x00, 0x01})
+	c.Assert(err, check.IsNil)
+	c.Assert(data, check.DeepEquals, []byte{0x00, 0x01})
+}
+
+func (e *EncoderTest) TestMsgpackEncoder(c *check.C) {
+	data, err := MsgpackEncoder.Encode(map[string]interface{}{
+		"age":   42,
+		"name":  "test",
+		"roles": []string{"admin", "dev"},
+	})
+	c.Assert(err, check.IsNil)
+
+	var user decodedUser
+	c.Assert(MsgpackDecoder.Decode(data, &user), check.IsNil)
+	c.Assert(user, check.DeepEquals, decodedUser{Name: "test", Age: 42, Roles: []string{"admin", "dev"}})
+}
+
+func (e *EncoderTest) TestMsgpackEncoderRoundTrip(c *check.C) {
+	long := string(make([]byte, 300))
+	values := []interface{}{nil, true, false, int64(-1), int64(-100), int64(-40000), int64(200), int64(1 << 40), int64(math.MaxInt64), int64(math.MinInt64), 1.5, "", long}
+	for _, value := range values {
+		data, err := MsgpackEncoder.Encode(value)
+		c.Assert(err, check.IsNil)
+		decoded, err := parseMsgpack(data)
+		c.Assert(err, check.IsNil)
+		c.Assert(decoded, check.DeepEquals, value)
+	}
+}
+
+func (e *EncoderTest) TestProtobufEncoder(c *check.C) {
+	data, err := ProtobufEncoder.Encode(protobufPayload{})
+	c.Assert(err, check.IsNil)
+	c.Assert(data, check.DeepEquals, []byte{0x08, 0x2a})
+
+	_, err = ProtobufEncoder.Encode("not a message")
+	c.Assert(err, check.NotNil)
+}
@@ -0,0 +1,192 @@
+package gohttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Error classes matched by `errors.Is` against an `*HTTPError`.
+var (
+	// ErrClientError matches HTTP errors with a 4xx status code.
+	ErrClientError = errors.New("gohttp: client error")
+
+	// ErrServerError matches HTTP errors with a 5xx status code.
+	ErrServerError = errors.New("gohttp: server error")
+)
+
+// ErrorDecoder decodes the body of an unsuccessful response, typically into
+// the error envelope of an API. The decoded value is exposed as the Body of
+// the resulting `*HTTPError`.
+type ErrorDecoder func(response *Response) (interface{}, error)
+
+// HTTPError is returned for a response with a non-2xx status code when the
+// `ReturnHTTPErrors` option of the `gohttp.Client` is enabled.
+type HTTPError struct {
+
+	// StatusCode is the status code of the response.
+	StatusCode int
+
+	// Header contains the response headers.
+	Header http.Header
+
+	// Data contains the raw response data.
+	Data []byte
+
+	// Body is the response body, decoded by the ErrorDecoder of the client if
+	// one is configured.
+	Body interface{}
+
+	// Request is the gohttp.Request object that generated the response.
+	Request *Request
+
+	// Response is the gohttp.Response object the error was built from.
+	Response *Response
+}
+
+// NewHTTPError builds an `*HTTPError` from a response, decoding its body with
+// decoder when one is supplied.
+func NewHTTPError(response *Response, decoder ErrorDecoder) *HTTPError {
+	httpErr := &HTTPError{
+		StatusCode: response.Code,
+		Header:     response.Header,
+		Data:       response.Data,
+		Body:       response.Body,
+		Request:    response.Request,
+		Response:   response,
+	}
+	if decoder != nil {
+		if body, err := decoder(response); err == nil {
+			httpErr.Body = body
+		}
+	}
+	return httpErr
+}
+
+func (e *HTTPError) Error() string {
+	if e.Request != nil {
+		return fmt.Sprintf("gohttp: %s %s: %d %s", e.Request.Method, e.Request.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("gohttp: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is reports whether the error belongs to the class of target, which is either
+// ErrClientError, ErrServerError or an `*HTTPError` with the same status code.
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrClientError:
+		return e.StatusCode >= 400 && e.StatusCode < 500
+	case ErrServerError:
+		return e.StatusCode >= 500 && e.StatusCode < 600
+	}
+	if t, ok := target.(*HTTPError); ok {
+		return t.StatusCode == e.StatusCode
+	}
+	return false
+}
+
+//------------------------------------------------------------------------------
+// Retry Exhaustion
+//------------------------------------------------------------------------------
+
+// Attempt records the outcome of a single attempt of a request.
+type Attempt struct {
+
+	// StatusCode is the status code of the response, or zero if no response
+	// was received.
+	StatusCode int
+
+	// Err is the transport error of the attempt, if any.
+	Err error
+}
+
+func (a Attempt) String() string {
+	if a.Err != nil {
+		return a.Err.Error()
+	}
+	return fmt.Sprintf("%d %s", a.StatusCode, http.StatusText(a.StatusCode))
+}
+
+// RetryExhaustedError is returned when the backoff policy gives up on a request
+// that the retry policy still wanted to retry.
+type RetryExhaustedError struct {
+
+	// Attempts records the outcome of every attempt, in order.
+	Attempts []Attempt
+
+	// Elapsed is the total time spent attempting the request.
+	Elapsed time.Duration
+
+	// Response is the response to the final attempt, or nil if it failed
+	// with a transport error.
+	Response *Response
+
+	// Err is the error of the final attempt: its transport error, or an
+	// `*HTTPError` built from its response.
+	Err error
+}
+
+// NewRetryExhaustedError builds a `*RetryExhaustedError` from the recorded
+// attempts and the response to the final one, whose body is decoded with
+// decoder when one is supplied.
+func NewRetryExhaustedError(attempts []Attempt, elapsed time.Duration, response *Response, decoder ErrorDecoder) *RetryExhaustedError {
+	exhausted := &RetryExhaustedError{
+		Attempts: attempts,
+		Elapsed:  elapsed,
+		Response: response,
+	}
+	if len(attempts) > 0 {
+		exhausted.Err = attempts[len(attempts)-1].Err
+	}
+	if exhausted.Err == nil && response != nil {
+		exhausted.Err = NewHTTPError(response, decoder)
+	}
+	return exhausted
+}
+
+func (e *RetryExhaustedError) Error() string {
+	outcomes := make([]string, len(e.Attempts))
+	for i, attempt := range e.Attempts {
+		outcomes[i] = attempt.String()
+	}
+	return fmt.Sprintf("gohttp: giving up after %d attempts in %v: [%s]", len(e.Attempts), e.Elapsed, strings.Join(outcomes, ", "))
+}
+
+// Unwrap returns the error of the final attempt.
+func (e *RetryExhaustedError) Unwrap() error {
+	return e.Err
+}
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+// IsClientError reports whether err is an HTTP error with a 4xx status code.
+func IsClientError(err error) bool {
+	return errors.Is(err, ErrClientError)
+}
+
+// IsServerError reports whether err is an HTTP error with a 5xx status code.
+func IsServerError(err error) bool {
+	return errors.Is(err, ErrServerError)
+}
+
+// IsStatus reports whether err is an HTTP error with one of the status codes.
+func IsStatus(err error, codes ...int) bool {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		return false
+	}
+	for _, code := range codes {
+		if code == httpErr.StatusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func isSuccess(code int) bool {
+	return code >= 200 && code < 300
+}
@@ -0,0 +1,62 @@
+package gohttp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type ErrorsTest struct{}
+
+var _ = check.Suite(&ErrorsTest{})
+
+func (e *ErrorsTest) TestErrorClasses(c *check.C) {
+	notFound := NewHTTPError(&Response{Code: http.StatusNotFound}, nil)
+	unavailable := NewHTTPError(&Response{Code: http.StatusServiceUnavailable}, nil)
+
+	c.Assert(IsClientError(notFound), check.Equals, true)
+	c.Assert(IsServerError(notFound), check.Equals, false)
+	c.Assert(IsClientError(unavailable), check.Equals, false)
+	c.Assert(IsServerError(unavailable), check.Equals, true)
+	c.Assert(IsStatus(notFound, http.StatusNotFound, http.StatusGone), check.Equals, true)
+	c.Assert(IsStatus(unavailable, http.StatusNotFound), check.Equals, false)
+	c.Assert(errors.Is(notFound, &HTTPError{StatusCode: http.StatusNotFound}), check.Equals, true)
+}
+
+func (e *ErrorsTest) TestErrorClassesThroughWrapping(c *check.C) {
+	err := fmt.Errorf("fetching user: %w", NewHTTPError(&Response{Code: http.StatusNotFound}, nil))
+	c.Assert(IsClientError(err), check.Equals, true)
+	c.Assert(IsStatus(err, http.StatusNotFound), check.Equals, true)
+
+	var httpErr *HTTPError
+	c.Assert(errors.As(err, &httpErr), check.Equals, true)
+	c.Assert(httpErr.StatusCode, check.Equals, http.StatusNotFound)
+}
+
+func (e *ErrorsTest) TestErrorDecoder(c *check.C) {
+	response := &Response{Code: http.StatusBadRequest, Data: []byte(`{"message":"invalid"}`)}
+	decoder := func(response *Response) (interface{}, error) {
+		envelope := struct {
+			Message string `json:"message"`
+		}{}
+		err := response.Unmarshal(&envelope)
+		return envelope.Message, err
+	}
+
+	httpErr := NewHTTPError(response, decoder)
+	c.Assert(httpErr.Body, check.Equals, "invalid")
+	c.Assert(httpErr.Data, check.DeepEquals, response.Data)
+}
+
+func (e *ErrorsTest) TestRetryExhaustedWithTransportError(c *check.C) {
+	attempts := []Attempt{{StatusCode: http.StatusServiceUnavailable}, {Err: io.ErrUnexpectedEOF}}
+	err := NewRetryExhaustedError(attempts, time.Second, nil, nil)
+
+	c.Assert(errors.Is(err, io.ErrUnexpectedEOF), check.Equals, true)
+	c.Assert(IsServerError(err), check.Equals, false)
+	c.Assert(err.Error(), check.Equals, "gohttp: giving up after 2 attempts in 1s: [503 Service Unavailable, unexpected EOF]")
+}
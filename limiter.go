@@ -0,0 +1,353 @@
+package gohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/meshhq/funnel"
+	"github.com/meshhq/meshRedis"
+)
+
+// RateLimiter paces the requests issued by a `gohttp.Client`.
+//
+// Wait blocks until the next request may be issued, or until ctx is done in
+// which case it returns `ctx.Err()`. A limiter that cannot reach its backing
+// store returns a `*RateLimiterError`. Implementations must be safe for
+// concurrent use.
+type RateLimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// Releaser is implemented by rate limiters that can give back a slot taken by
+// a successful Wait. A `gohttp.Client` releases the slots of a request that
+// is abandoned because another of its limiters failed.
+type Releaser interface {
+	Release()
+}
+
+// RateLimiterError is returned by a RateLimiter that failed to decide whether
+// a request may proceed, typically because its backing store is unavailable.
+type RateLimiterError struct {
+
+	// Err is the underlying failure.
+	Err error
+}
+
+func (e *RateLimiterError) Error() string {
+	return fmt.Sprintf("gohttp: rate limiter unavailable: %v", e.Err)
+}
+
+// Unwrap returns the underlying failure.
+func (e *RateLimiterError) Unwrap() error {
+	return e.Err
+}
+
+// RateLimiterFailureMode controls how a `gohttp.Client` behaves when its
+// RateLimiter returns a `*RateLimiterError`.
+type RateLimiterFailureMode int
+
+// Rate limiter failure modes.
+const (
+	// FailClosed aborts the request with the limiter error.
+	FailClosed RateLimiterFailureMode = iota
+
+	// FailOpen lets the request through without rate limiting.
+	FailOpen
+)
+
+// RateLimiterHook is notified after every rate limiter wait with the time
+// spent waiting and the error returned by the limiter, if any.
+type RateLimiterHook func(wait time.Duration, err error)
+
+//------------------------------------------------------------------------------
+// Route Limits
+//------------------------------------------------------------------------------
+
+// RouteLimit binds a RateLimiter to the requests matching a host, a method and
+// a path pattern. Empty fields match every request.
+//
+// Path is matched against the path of the URL of the `gohttp.Request`, which
+// is relative to the BaseURL of the client, with `path.Match` syntax, so
+// "/users/*/posts" matches "/users/1/posts". A pattern ending with a slash
+// matches every path below it, so "/search/" matches "/search/users".
+type RouteLimit struct {
+
+	// Host is the host, including the port if any, of the matching requests.
+	Host string
+
+	// Method is the HTTP method of the matching requests.
+	Method string
+
+	// Path is the path pattern of the matching requests.
+	Path string
+
+	// Limiter is the rate limiter applied to the matching requests.
+	Limiter RateLimiter
+}
+
+// Matches reports whether a request with the given method, host and path
+// falls under the route limit.
+func (l RouteLimit) Matches(method string, host string, requestPath string) bool {
+	if l.Host != "" && !strings.EqualFold(l.Host, host) {
+		return false
+	}
+	if l.Method != "" && l.Method != method {
+		return false
+	}
+	if l.Path == "" {
+		return true
+	}
+	if strings.HasSuffix(l.Path, "/") {
+		return strings.HasPrefix(requestPath, l.Path)
+	}
+	matched, err := path.Match(l.Path, requestPath)
+	return err == nil && matched
+}
+
+//------------------------------------------------------------------------------
+// Sliding Window Limiter
+//------------------------------------------------------------------------------
+
+// SlidingWindowLimiter is an in-process RateLimiter that admits at most a
+// given number of requests within any window of a given interval. It is
+// instantiated with NewSlidingWindowLimiter.
+type SlidingWindowLimiter struct {
+	interval time.Duration
+
+	// mutex guards admitted and next.
+	mutex sync.Mutex
+
+	// admitted is a ring buffer holding the admission time of the most recent
+	// requests. The slot at next holds the oldest one.
+	admitted []time.Time
+	next     int
+}
+
+// NewSlidingWindowLimiter instantiates a SlidingWindowLimiter admitting
+// maxRequests requests per interval.
+func NewSlidingWindowLimiter(maxRequests int, interval time.Duration) *SlidingWindowLimiter {
+	if maxRequests < 1 {
+		maxRequests = 1
+	}
+	return &SlidingWindowLimiter{
+		interval: interval,
+		admitted: make([]time.Time, maxRequests),
+	}
+}
+
+// Wait blocks until fewer than the maxRequests passed to
+// NewSlidingWindowLimiter were admitted within the last interval.
+func (l *SlidingWindowLimiter) Wait(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		l.mutex.Lock()
+		now := time.Now()
+		oldest := l.admitted[l.next]
+		elapsed := now.Sub(oldest)
+		if oldest.IsZero() || elapsed >= l.interval {
+			l.admitted[l.next] = now
+			l.next = (l.next + 1) % len(l.admitted)
+			l.mutex.Unlock()
+			return nil
+		}
+		l.mutex.Unlock()
+
+		timer := time.NewTimer(l.interval - elapsed)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Release gives back the most recent admission.
+func (l *SlidingWindowLimiter) Release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// The released slot becomes the oldest one, free for the next request.
+	l.next = (l.next + len(l.admitted) - 1) % len(l.admitted)
+	l.admitted[l.next] = time.Time{}
+}
+
+//------------------------------------------------------------------------------
+// Funnel Limiter
+//------------------------------------------------------------------------------
+
+// DefaultFunnelTimeout bounds every round trip of a FunnelLimiter to Redis.
+const DefaultFunnelTimeout = 5 * time.Second
+
+// funnelScript atomically enters the fixed window of a Funnel token, which is
+// a list holding one item per admitted request and expiring with the window.
+// It returns -1 once the request is admitted, or the number of milliseconds
+// left before the window resets.
+const funnelScript = `
+local count = redis.call('LLEN', KEYS[1])
+if count < tonumber(ARGV[1]) then
+	redis.call('RPUSH', KEYS[1], ARGV[2])
+	if count == 0 then
+		redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	end
+	return -1
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+	return tonumber(ARGV[3])
+end
+return ttl
+`
+
+// redisPool vends Redis connections. It is satisfied by `*redis.Pool`.
+type redisPool interface {
+	GetContext(ctx context.Context) (redis.Conn, error)
+}
+
+// FunnelLimiter is a distributed RateLimiter sharing the window of a Funnel
+// token across processes through Redis.
+//
+// It uses the same Redis keys as Funnel, but enters the window with a single
+// atomic script instead of Funnel's locking retry loop. Every round trip is
+// bounded by Timeout, Redis failures are returned as `*RateLimiterError`, and
+// a slot taken for a caller whose context is already done is given back.
+type FunnelLimiter struct {
+
+	// Timeout bounds every round trip to Redis.
+	Timeout time.Duration
+
+	pool        redisPool
+	key         string
+	maxRequests int
+	interval    time.Duration
+}
+
+// NewFunnelLimiter instantiates a FunnelLimiter. meshRedis must be set up.
+func NewFunnelLimiter(limitInfo *funnel.RateLimitInfo) (*FunnelLimiter, error) {
+	pool := meshRedis.UnderlyingPool()
+	if pool == nil {
+		return nil, errors.New("gohttp: meshRedis is not set up")
+	}
+	return newFunnelLimiter(pool, limitInfo), nil
+}
+
+func newFunnelLimiter(pool redisPool, limitInfo *funnel.RateLimitInfo) *FunnelLimiter {
+	interval := time.Duration(limitInfo.TimeInterval) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+	maxRequests := limitInfo.MaxRequests
+	if maxRequests < 1 {
+		maxRequests = 1
+	}
+
+	// Funnel suffixes the token twice to name the list of its window.
+	return &FunnelLimiter{
+		Timeout:     DefaultFunnelTimeout,
+		pool:        pool,
+		key:         limitInfo.Token + "_rateLimiterToken_rateLimiterToken",
+		maxRequests: maxRequests,
+		interval:    interval,
+	}
+}
+
+// Wait blocks until the request enters the current window, or until ctx is
+// done, whichever happens first.
+func (l *FunnelLimiter) Wait(ctx context.Context) error {
+	for {
+		delay, err := l.enter(ctx)
+		if err != nil {
+			return err
+		}
+		if delay == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// funnelResult is the outcome of a single attempt to enter the window.
+type funnelResult struct {
+	delay time.Duration
+	err   error
+}
+
+// enter makes a single attempt to enter the window. It returns zero once the
+// request is admitted, or the delay before the window resets. The round trip
+// runs aside so that enter returns as soon as ctx is done; a slot taken after
+// that point is released, since no request will use it.
+func (l *FunnelLimiter) enter(ctx context.Context) (time.Duration, error) {
+	results := make(chan funnelResult)
+	go func() {
+		delay, err := l.eval(ctx)
+		select {
+		case results <- funnelResult{delay: delay, err: err}:
+		case <-ctx.Done():
+			if err == nil && delay == 0 {
+				l.Release()
+			}
+		}
+	}()
+
+	select {
+	case result := <-results:
+		if result.err != nil {
+			return 0, &RateLimiterError{Err: result.err}
+		}
+		return result.delay, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// eval runs funnelScript.
+func (l *FunnelLimiter) eval(ctx context.Context) (time.Duration, error) {
+	conn, err := l.pool.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	remaining, err := redis.Int64(redis.DoWithTimeout(conn, l.Timeout, "EVAL", funnelScript, 1,
+		l.key, l.maxRequests, l.key, int64(l.interval/time.Millisecond)))
+	if err != nil {
+		return 0, err
+	}
+	if remaining < 0 {
+		return 0, nil
+	}
+	if remaining == 0 {
+		remaining = 1
+	}
+	return time.Duration(remaining) * time.Millisecond, nil
+}
+
+// Release gives back a slot of the current window.
+func (l *FunnelLimiter) Release() {
+	ctx, cancel := context.WithTimeout(context.Background(), l.Timeout)
+	defer cancel()
+
+	conn, err := l.pool.GetContext(ctx)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	redis.DoWithTimeout(conn, l.Timeout, "LREM", l.key, 1, l.key)
+}
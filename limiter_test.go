@@ -0,0 +1,195 @@
+package gohttp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/meshhq/funnel"
+	"github.com/meshhq/meshRedis"
+	"gopkg.in/check.v1"
+)
+
+type LimiterTest struct{}
+
+var _ = check.Suite(&LimiterTest{})
+
+func (l *LimiterTest) TestSlidingWindowAdmitsBurst(c *check.C) {
+	limiter := NewSlidingWindowLimiter(3, time.Hour)
+	for i := 0; i < 3; i++ {
+		c.Assert(limiter.Wait(context.Background()), check.IsNil)
+	}
+}
+
+func (l *LimiterTest) TestSlidingWindowBlocksUntilWindowSlides(c *check.C) {
+	limiter := NewSlidingWindowLimiter(2, 100*time.Millisecond)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		c.Assert(limiter.Wait(context.Background()), check.IsNil)
+	}
+	c.Assert(time.Since(start) >= 100*time.Millisecond, check.Equals, true)
+}
+
+func (l *LimiterTest) TestSlidingWindowHonorsContext(c *check.C) {
+	limiter := NewSlidingWindowLimiter(1, time.Hour)
+	c.Assert(limiter.Wait(context.Background()), check.IsNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(limiter.Wait(ctx), check.Equals, context.DeadlineExceeded)
+}
+
+func (l *LimiterTest) TestFunnelLimiterWithRedisUnavailable(c *check.C) {
+	url := os.Getenv("REDIS_URL")
+	os.Setenv("REDIS_URL", "redis://127.0.0.1:1")
+	defer os.Setenv("REDIS_URL", url)
+
+	c.Assert(meshRedis.SetupRedis(), check.NotNil)
+	defer meshRedis.ClosePool()
+
+	limiter, err := NewFunnelLimiter(&funnel.RateLimitInfo{
+		Token:        "unavailable",
+		MaxRequests:  10,
+		TimeInterval: 1000,
+	})
+	c.Assert(err, check.IsNil)
+
+	err = limiter.Wait(context.Background())
+	limiterErr, ok := err.(*RateLimiterError)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(limiterErr.Err, check.NotNil)
+}
+
+func (l *LimiterTest) TestFunnelLimiterWaitsForTheWindow(c *check.C) {
+	store := &fakeRedis{}
+	store.reply = func(command string, args ...interface{}) (interface{}, error) {
+		if len(store.commandList()) == 2 {
+			return int64(50), nil
+		}
+		return int64(-1), nil
+	}
+	limiter := newFunnelLimiter(store, &funnel.RateLimitInfo{Token: "gmail", MaxRequests: 1, TimeInterval: 1000})
+
+	start := time.Now()
+	c.Assert(limiter.Wait(context.Background()), check.IsNil)
+	c.Assert(limiter.Wait(context.Background()), check.IsNil)
+	c.Assert(time.Since(start) >= 50*time.Millisecond, check.Equals, true)
+	c.Assert(store.commandList(), check.DeepEquals, []string{"EVAL", "EVAL", "EVAL"})
+	c.Assert(store.args[0][2], check.Equals, "gmail_rateLimiterToken_rateLimiterToken")
+}
+
+func (l *LimiterTest) TestFunnelLimiterWithRedisFailure(c *check.C) {
+	store := &fakeRedis{reply: func(command string, args ...interface{}) (interface{}, error) {
+		return nil, errors.New("READONLY You can't write against a read only replica")
+	}}
+	limiter := newFunnelLimiter(store, &funnel.RateLimitInfo{Token: "gmail", MaxRequests: 1, TimeInterval: 1000})
+
+	err := limiter.Wait(context.Background())
+	limiterErr, ok := err.(*RateLimiterError)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(limiterErr.Err, check.ErrorMatches, "READONLY.*")
+}
+
+func (l *LimiterTest) TestFunnelLimiterReleasesSlotOfCanceledCaller(c *check.C) {
+	unblock := make(chan struct{})
+	store := &fakeRedis{}
+	store.reply = func(command string, args ...interface{}) (interface{}, error) {
+		if command == "EVAL" {
+			<-unblock
+			return int64(-1), nil
+		}
+		return int64(1), nil
+	}
+	limiter := newFunnelLimiter(store, &funnel.RateLimitInfo{Token: "gmail", MaxRequests: 1, TimeInterval: 1000})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(limiter.Wait(ctx), check.Equals, context.DeadlineExceeded)
+
+	close(unblock)
+	for i := 0; i < 100 && len(store.commandList()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(store.commandList(), check.DeepEquals, []string{"EVAL", "LREM"})
+}
+
+func (l *LimiterTest) TestSlidingWindowRelease(c *check.C) {
+	limiter := NewSlidingWindowLimiter(2, time.Hour)
+	c.Assert(limiter.Wait(context.Background()), check.IsNil)
+	c.Assert(limiter.Wait(context.Background()), check.IsNil)
+	limiter.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(limiter.Wait(ctx), check.IsNil)
+	c.Assert(limiter.Wait(ctx), check.Equals, context.DeadlineExceeded)
+}
+
+func (l *LimiterTest) TestRouteLimitMatching(c *check.C) {
+	host, path := "api.example.com", "/users/1/posts"
+
+	c.Assert(RouteLimit{}.Matches(GET, host, path), check.Equals, true)
+	c.Assert(RouteLimit{Host: "api.example.com"}.Matches(GET, host, path), check.Equals, true)
+	c.Assert(RouteLimit{Host: "other.example.com"}.Matches(GET, host, path), check.Equals, false)
+	c.Assert(RouteLimit{Method: GET}.Matches(GET, host, path), check.Equals, true)
+	c.Assert(RouteLimit{Method: POST}.Matches(GET, host, path), check.Equals, false)
+	c.Assert(RouteLimit{Path: "/users/*/posts"}.Matches(GET, host, path), check.Equals, true)
+	c.Assert(RouteLimit{Path: "/users/*"}.Matches(GET, host, path), check.Equals, false)
+	c.Assert(RouteLimit{Path: "/users/"}.Matches(GET, host, path), check.Equals, true)
+	c.Assert(RouteLimit{Path: "/search/"}.Matches(GET, host, path), check.Equals, false)
+}
+
+func (l *LimiterTest) TestRoutePath(c *check.C) {
+	c.Assert((&Request{URL: "users/1?page=2"}).routePath(), check.Equals, "/users/1")
+	c.Assert((&Request{URL: "/users/../admin/"}).routePath(), check.Equals, "/admin/")
+	c.Assert((&Request{URL: "https://other.example.com/users"}).routePath(), check.Equals, "/users")
+	c.Assert((&Request{URL: "//users/1"}).routePath(), check.Equals, "/users/1")
+	c.Assert((&Request{URL: "/users/{id}", PathParams: map[string]string{"id": "a b"}}).routePath(), check.Equals, "/users/a b")
+}
+
+// fakeRedis is a redisPool whose connections answer every command with reply.
+type fakeRedis struct {
+	mutex    sync.Mutex
+	reply    func(command string, args ...interface{}) (interface{}, error)
+	commands []string
+	args     [][]interface{}
+}
+
+func (f *fakeRedis) GetContext(ctx context.Context) (redis.Conn, error) {
+	return &fakeRedisConn{redis: f}, nil
+}
+
+func (f *fakeRedis) commandList() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string(nil), f.commands...)
+}
+
+type fakeRedisConn struct {
+	redis *fakeRedis
+}
+
+func (c *fakeRedisConn) DoWithTimeout(timeout time.Duration, command string, args ...interface{}) (interface{}, error) {
+	c.redis.mutex.Lock()
+	c.redis.commands = append(c.redis.commands, command)
+	c.redis.args = append(c.redis.args, args)
+	c.redis.mutex.Unlock()
+	return c.redis.reply(command, args...)
+}
+
+func (c *fakeRedisConn) Do(command string, args ...interface{}) (interface{}, error) {
+	return c.DoWithTimeout(0, command, args...)
+}
+
+func (c *fakeRedisConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return nil, nil
+}
+
+func (c *fakeRedisConn) Close() error                                   { return nil }
+func (c *fakeRedisConn) Err() error                                     { return nil }
+func (c *fakeRedisConn) Send(command string, args ...interface{}) error { return nil }
+func (c *fakeRedisConn) Flush() error                                   { return nil }
+func (c *fakeRedisConn) Receive() (interface{}, error)                  { return nil, nil }
@@ -0,0 +1,37 @@
+package gohttp
+
+import "net/http"
+
+// Handler executes a translated `http.Request` and returns the parsed
+// response.
+type Handler func(req *http.Request) (*Response, error)
+
+// Middleware wraps a Handler. A middleware can inspect or modify the outgoing
+// request before calling next, inspect or replace the response it returns, or
+// short-circuit the execution by returning without calling next.
+//
+// Middleware runs at two levels on a `gohttp.Client`:
+//
+//   - Middleware wraps the whole execution of a request: rate limiting and
+//     every retry attempt happen inside next, so a middleware can retry, or
+//     give up on, the request as a whole. Calling next again with the same
+//     request sends its body again.
+//   - AttemptMiddleware wraps every single attempt, inside the retry loop.
+//
+// Within a level, the first middleware in the chain is the outermost one: it
+// sees the request first and the response last. The middleware of the
+// `gohttp.Client` run outside the middleware of the `gohttp.Request`.
+type Middleware func(next Handler) Handler
+
+// chain wraps handler with the given middleware so that the first one is the
+// outermost.
+func chain(handler Handler, middleware ...[]Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		for j := len(middleware[i]) - 1; j >= 0; j-- {
+			if middleware[i][j] != nil {
+				handler = middleware[i][j](handler)
+			}
+		}
+	}
+	return handler
+}
@@ -0,0 +1,97 @@
+package gohttp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"gopkg.in/check.v1"
+)
+
+type MiddlewareTest struct{}
+
+var _ = check.Suite(&MiddlewareTest{})
+
+func recordingMiddleware(name string, trace *[]string) Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*Response, error) {
+			*trace = append(*trace, name+" before")
+			response, err := next(req)
+			*trace = append(*trace, name+" after")
+			return response, err
+		}
+	}
+}
+
+func (m *MiddlewareTest) TestChainOrdering(c *check.C) {
+	var trace []string
+	handler := func(req *http.Request) (*Response, error) {
+		trace = append(trace, "handler")
+		return &Response{Code: http.StatusOK}, nil
+	}
+
+	client := []Middleware{recordingMiddleware("client 1", &trace), recordingMiddleware("client 2", &trace)}
+	request := []Middleware{recordingMiddleware("request", &trace)}
+	_, err := chain(handler, client, request)(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(trace, check.DeepEquals, []string{
+		"client 1 before",
+		"client 2 before",
+		"request before",
+		"handler",
+		"request after",
+		"client 2 after",
+		"client 1 after",
+	})
+}
+
+func (m *MiddlewareTest) TestChainWithoutMiddleware(c *check.C) {
+	handler := func(req *http.Request) (*Response, error) {
+		return &Response{Code: http.StatusTeapot}, nil
+	}
+	response, err := chain(handler)(nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusTeapot)
+}
+
+func (m *MiddlewareTest) TestMiddlewareResendsBody(c *check.C) {
+	var mutex sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mutex.Lock()
+		bodies = append(bodies, string(body))
+		mutex.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, nil)
+	client.Middleware = []Middleware{func(next Handler) Handler {
+		return func(req *http.Request) (*Response, error) {
+			if _, err := next(req); err != nil {
+				return nil, err
+			}
+			return next(req)
+		}
+	}}
+
+	multipart := NewMultipart()
+	multipart.AddField("name", strings.Repeat("x", 1<<16))
+	payload := strings.Repeat("0123456789abcdef", 1<<12)
+	for _, body := range []interface{}{multipart, strings.NewReader(payload)} {
+		bodies = nil
+		response, err := client.Execute(&Request{Method: POST, Body: body})
+		c.Assert(err, check.IsNil)
+		c.Assert(response.Code, check.Equals, http.StatusOK)
+		c.Assert(bodies, check.HasLen, 2)
+		c.Assert(bodies[1], check.Equals, bodies[0])
+		if _, ok := body.(*Multipart); ok {
+			c.Assert(int64(len(bodies[0])), check.Equals, multipart.ContentLength())
+		} else {
+			c.Assert(bodies[0], check.Equals, payload)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package gohttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ErrMultipartConsumed is returned when the multipart body of a request is
+// sent again after one of its readers, which cannot be rewound, was consumed.
+var ErrMultipartConsumed = errors.New("gohttp: multipart reader already consumed")
+
+// Multipart models a multipart/form-data request body, made of text fields and
+// files. A Multipart is used as the Body of a `gohttp.Request`.
+//
+// The body is streamed through a pipe as it is sent, so files are never held
+// in memory. Files added from disk are reopened, and readers implementing
+// `io.Seeker` rewound, on every attempt of the request, so the body can be
+// replayed when the request is retried. Other readers can only be sent once,
+// and a request carrying one fails with ErrBodyNotReplayable if it needs to be
+// retried.
+//
+// A Multipart made of fields and files from disk can be sent by concurrent
+// requests. Readers added with AddReader are shared by every request sending
+// the body, which must then not be executed concurrently.
+type Multipart struct {
+	boundary string
+	parts    []*multipartPart
+}
+
+// multipartPart models a single part of a multipart body.
+type multipartPart struct {
+	name        string
+	file        bool
+	filename    string
+	contentType string
+
+	// open returns the content of the part. size is the length of the content,
+	// or -1 when unknown.
+	open       func() (io.ReadCloser, error)
+	size       int64
+	replayable bool
+}
+
+// NewMultipart instantiates an empty `gohttp.Multipart` body.
+func NewMultipart() *Multipart {
+	return &Multipart{boundary: multipart.NewWriter(nil).Boundary()}
+}
+
+// AddField adds a text field.
+func (m *Multipart) AddField(name string, value string) {
+	m.parts = append(m.parts, &multipartPart{
+		name: name,
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(value)), nil
+		},
+		size:       int64(len(value)),
+		replayable: true,
+	})
+}
+
+// AddFile adds the file at path. The filename of the part is the base name of
+// the path, and its content type is derived from the extension, defaulting to
+// application/octet-stream. The file is opened when the request is sent.
+func (m *Multipart) AddFile(name string, path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("gohttp: %s is a directory", path)
+	}
+
+	m.parts = append(m.parts, &multipartPart{
+		name:        name,
+		file:        true,
+		filename:    filepath.Base(path),
+		contentType: mime.TypeByExtension(filepath.Ext(path)),
+		open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+		size:       info.Size(),
+		replayable: true,
+	})
+	return nil
+}
+
+// AddReader adds a file read from reader, with the given filename and content
+// type. An empty content type defaults to application/octet-stream. Readers
+// implementing `io.Seeker` are rewound to their current position on every
+// attempt; other readers can only be sent once.
+func (m *Multipart) AddReader(name string, filename string, contentType string, reader io.Reader) error {
+	part := &multipartPart{
+		name:        name,
+		file:        true,
+		filename:    filename,
+		contentType: contentType,
+		size:        -1,
+	}
+
+	if seeker, ok := reader.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+
+		part.size = end - start
+		part.replayable = true
+		part.open = func() (io.ReadCloser, error) {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(reader), nil
+		}
+	} else {
+		consumed := false
+		part.open = func() (io.ReadCloser, error) {
+			if consumed {
+				return nil, ErrMultipartConsumed
+			}
+			consumed = true
+			return ioutil.NopCloser(reader), nil
+		}
+	}
+
+	m.parts = append(m.parts, part)
+	return nil
+}
+
+// ContentType returns the `Content-Type` of the body, including its boundary.
+func (m *Multipart) ContentType() string {
+	return "multipart/form-data; boundary=" + m.boundary
+}
+
+// ContentLength returns the length of the encoded body, or -1 if the size of
+// one of its readers is unknown.
+func (m *Multipart) ContentLength() int64 {
+	counter := &countingWriter{}
+	writer := m.newWriter(counter)
+	var size int64
+	for _, part := range m.parts {
+		if part.size < 0 {
+			return -1
+		}
+		if _, err := writer.CreatePart(part.header()); err != nil {
+			return -1
+		}
+		size += part.size
+	}
+	if err := writer.Close(); err != nil {
+		return -1
+	}
+	return counter.n + size
+}
+
+// replayable returns whether the body can be sent more than once.
+func (m *Multipart) replayable() bool {
+	for _, part := range m.parts {
+		if !part.replayable {
+			return false
+		}
+	}
+	return true
+}
+
+// Reader returns a reader streaming the encoded body. The parts are written
+// through a pipe once the reader is first read, and closing the reader stops
+// them.
+func (m *Multipart) Reader() io.ReadCloser {
+	return &multipartReader{multipart: m}
+}
+
+// multipartReader lazily starts writing a multipart body to a pipe, so that
+// no goroutine is left behind by a request that is never sent.
+type multipartReader struct {
+	multipart *Multipart
+	attempts  *multipartAttempts
+	once      sync.Once
+	reader    *io.PipeReader
+	done      chan struct{}
+}
+
+func (r *multipartReader) start() {
+	r.once.Do(func() {
+		if r.attempts != nil {
+			r.attempts.activate(r)
+		}
+		reader, writer := io.Pipe()
+		r.reader = reader
+		r.done = make(chan struct{})
+		go func() {
+			defer close(r.done)
+			writer.CloseWithError(r.multipart.writeTo(writer))
+		}()
+	})
+}
+
+func (r *multipartReader) Read(p []byte) (int, error) {
+	r.start()
+	if r.reader == nil {
+		return 0, io.ErrClosedPipe
+	}
+	return r.reader.Read(p)
+}
+
+// Close stops the writing goroutine, if it was started, and waits for it to
+// exit so that the parts can safely be read again.
+func (r *multipartReader) Close() error {
+	started := true
+	r.once.Do(func() { started = false })
+	if !started || r.reader == nil {
+		return nil
+	}
+	err := r.reader.Close()
+	<-r.done
+	return err
+}
+
+// multipartAttempts tracks the reader of the latest attempt of a request. The
+// writer of an attempt is stopped before the next attempt starts, as the parts
+// are read again; the transport may close the body of an attempt only after
+// the next one has started.
+type multipartAttempts struct {
+	mutex  sync.Mutex
+	active *multipartReader
+}
+
+// activate makes r the reader of the latest attempt, stopping the writer of
+// the previous one.
+func (a *multipartAttempts) activate(r *multipartReader) {
+	a.mutex.Lock()
+	previous := a.active
+	a.active = r
+	a.mutex.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+}
+
+func (m *Multipart) writeTo(w io.Writer) error {
+	writer := m.newWriter(w)
+	for _, part := range m.parts {
+		partWriter, err := writer.CreatePart(part.header())
+		if err != nil {
+			return err
+		}
+
+		content, err := part.open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(partWriter, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func (m *Multipart) newWriter(w io.Writer) *multipart.Writer {
+	writer := multipart.NewWriter(w)
+	writer.SetBoundary(m.boundary)
+	return writer
+}
+
+// request builds an `http.Request` streaming the multipart body. The body is
+// rebuilt for every attempt when all of its parts can be replayed.
+func (m *Multipart) request(ctx context.Context, method string, url string) (*http.Request, error) {
+	attempts := &multipartAttempts{}
+	req, err := http.NewRequestWithContext(ctx, method, url, &multipartReader{multipart: m, attempts: attempts})
+	if err != nil {
+		return nil, err
+	}
+
+	req.ContentLength = m.ContentLength()
+	if m.replayable() {
+		req.GetBody = func() (io.ReadCloser, error) {
+			return &multipartReader{multipart: m, attempts: attempts}, nil
+		}
+	}
+	return req, nil
+}
+
+// header returns the MIME header of the part.
+func (p *multipartPart) header() textproto.MIMEHeader {
+	disposition := fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(p.name))
+	header := textproto.MIMEHeader{}
+	if !p.file {
+		header.Set("Content-Disposition", disposition)
+		return header
+	}
+
+	header.Set("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, escapeQuotes(p.filename)))
+	contentType := p.contentType
+	if contentType == "" {
+		contentType = MediaTypeOctetStream
+	}
+	header.Set(ContentType, contentType)
+	return header
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// countingWriter counts the bytes written to it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,266 @@
+package gohttp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type MultipartTest struct {
+	server *httptest.Server
+
+	// attempts counts the requests received, and failures is the number of
+	// requests answered with a 500 before succeeding. When early is set, the
+	// failures are answered with a 503 before the body is read.
+	attempts int32
+	failures int32
+	early    bool
+}
+
+var _ = check.Suite(&MultipartTest{})
+
+func (m *MultipartTest) SetUpSuite(c *check.C) {
+	m.server = httptest.NewServer(http.HandlerFunc(m.handleUpload))
+}
+
+func (m *MultipartTest) SetUpTest(c *check.C) {
+	atomic.StoreInt32(&m.attempts, 0)
+	m.failures = 0
+	m.early = false
+}
+
+func (m *MultipartTest) TearDownSuite(c *check.C) {
+	m.server.Close()
+}
+
+func (m *MultipartTest) TestUploadFieldsAndFiles(c *check.C) {
+	path := filepath.Join(c.MkDir(), "report.txt")
+	c.Assert(ioutil.WriteFile(path, []byte("file content"), 0600), check.IsNil)
+
+	body := NewMultipart()
+	body.AddField("title", "Quarterly \"report\"")
+	c.Assert(body.AddFile("report", path), check.IsNil)
+	c.Assert(body.AddReader("data", "data.bin", "", bytes.NewReader([]byte{0x00, 0x01})), check.IsNil)
+
+	client := NewClient(m.server.URL, nil)
+	response, err := client.Execute(&Request{Method: POST, Body: body})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(string(response.Data), check.Equals, strings.Join([]string{
+		"data=data.bin|application/octet-stream|\x00\x01",
+		"report=report.txt|text/plain; charset=utf-8|file content",
+		`title=Quarterly "report"`,
+		"length=known",
+	}, "\n"))
+}
+
+func (m *MultipartTest) TestUploadReplaysOnRetry(c *check.C) {
+	path := filepath.Join(c.MkDir(), "data.json")
+	c.Assert(ioutil.WriteFile(path, []byte(`{"a":1}`), 0600), check.IsNil)
+
+	body := NewMultipart()
+	c.Assert(body.AddFile("file", path), check.IsNil)
+	c.Assert(body.AddReader("text", "text.txt", "text/plain", strings.NewReader("text")), check.IsNil)
+
+	m.failures = 2
+	client := NewClient(m.server.URL, nil)
+	client.RetryableStatusCodes = []int{500}
+	response, err := client.Execute(&Request{Method: POST, Body: body})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(atomic.LoadInt32(&m.attempts), check.Equals, int32(3))
+	c.Assert(strings.Contains(string(response.Data), `file=data.json|application/json|{"a":1}`), check.Equals, true)
+	c.Assert(strings.Contains(string(response.Data), "text=text.txt|text/plain|text"), check.Equals, true)
+}
+
+func (m *MultipartTest) TestUploadReplaysAfterEarlyResponse(c *check.C) {
+	content := strings.Repeat("0123456789abcdef", 1<<16)
+	body := NewMultipart()
+	c.Assert(body.AddReader("data", "data.bin", "", bytes.NewReader([]byte(content))), check.IsNil)
+
+	m.failures = 1
+	m.early = true
+	client := NewClient(m.server.URL, nil)
+	client.RetryableStatusCodes = []int{503}
+	response, err := client.Execute(&Request{Method: POST, Body: body})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(atomic.LoadInt32(&m.attempts), check.Equals, int32(2))
+	c.Assert(string(response.Data) == "data=data.bin|application/octet-stream|"+content+"\nlength=known", check.Equals, true)
+}
+
+func (m *MultipartTest) TestUploadSharedByConcurrentRequests(c *check.C) {
+	path := filepath.Join(c.MkDir(), "data.bin")
+	c.Assert(ioutil.WriteFile(path, make([]byte, 1<<22), 0600), check.IsNil)
+
+	body := NewMultipart()
+	body.AddField("title", "shared")
+	c.Assert(body.AddFile("file", path), check.IsNil)
+
+	// The server reads slowly, so that both uploads are in flight together.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buffer := make([]byte, 1<<15)
+		var received int64
+		for {
+			n, err := r.Body.Read(buffer)
+			received += int64(n)
+			if err != nil {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if received != r.ContentLength {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, nil)
+	var wait sync.WaitGroup
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			response, err := client.Execute(&Request{Method: POST, Body: body, Backoff: &BackoffOptions{MaxAttempts: 1}})
+			if err == nil && response.Code != http.StatusOK {
+				err = fmt.Errorf("upload truncated: %d", response.Code)
+			}
+			results <- err
+		}()
+	}
+	wait.Wait()
+	close(results)
+	for err := range results {
+		c.Assert(err, check.IsNil)
+	}
+}
+
+func (m *MultipartTest) TestReaderCloseWaitsForWriter(c *check.C) {
+	body := NewMultipart()
+	c.Assert(body.AddReader("data", "data.bin", "", bytes.NewReader(make([]byte, 1<<20))), check.IsNil)
+
+	reader := body.Reader().(*multipartReader)
+	_, err := reader.Read(make([]byte, 16))
+	c.Assert(err, check.IsNil)
+	c.Assert(reader.Close(), check.IsNil)
+	select {
+	case <-reader.done:
+	default:
+		c.Fatal("writer still running after Close")
+	}
+	c.Assert(reader.Close(), check.IsNil)
+}
+
+func (m *MultipartTest) TestUploadStreamsUnknownLength(c *check.C) {
+	body := NewMultipart()
+	reader, writer := io.Pipe()
+	go func() {
+		for i := 0; i < 1024; i++ {
+			writer.Write([]byte(strings.Repeat("x", 1024)))
+		}
+		writer.Close()
+	}()
+	c.Assert(body.AddReader("stream", "stream.bin", "", reader), check.IsNil)
+	c.Assert(body.ContentLength(), check.Equals, int64(-1))
+
+	client := NewClient(m.server.URL, nil)
+	response, err := client.Execute(&Request{Method: POST, Body: body})
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.HasSuffix(string(response.Data), "length=unknown"), check.Equals, true)
+	c.Assert(len(response.Data) > 1024*1024, check.Equals, true)
+}
+
+func (m *MultipartTest) TestUploadWithUnreplayableReader(c *check.C) {
+	body := NewMultipart()
+	c.Assert(body.AddReader("stream", "stream.bin", "", ioutil.NopCloser(strings.NewReader("once"))), check.IsNil)
+
+	m.failures = 1
+	client := NewClient(m.server.URL, nil)
+	client.RetryableStatusCodes = []int{500}
+	_, err := client.Execute(&Request{Method: POST, Body: body})
+	c.Assert(err, check.Equals, ErrBodyNotReplayable)
+	c.Assert(atomic.LoadInt32(&m.attempts), check.Equals, int32(1))
+}
+
+func (m *MultipartTest) TestAddMissingFile(c *check.C) {
+	body := NewMultipart()
+	err := body.AddFile("file", filepath.Join(c.MkDir(), "missing"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (m *MultipartTest) TestContentLength(c *check.C) {
+	body := NewMultipart()
+	body.AddField("a", "1")
+	c.Assert(body.AddReader("b", "b.txt", "text/plain", strings.NewReader("two")), check.IsNil)
+
+	data, err := ioutil.ReadAll(body.Reader())
+	c.Assert(err, check.IsNil)
+	c.Assert(body.ContentLength(), check.Equals, int64(len(data)))
+}
+
+//------------------------------------------------------------------------------
+// Handlers
+//------------------------------------------------------------------------------
+
+// handleUpload echoes the parts of a multipart request, sorted by name, as
+// "name=filename|content type|content" lines, or "name=value" for fields.
+func (m *MultipartTest) handleUpload(w http.ResponseWriter, r *http.Request) {
+	attempt := atomic.AddInt32(&m.attempts, 1)
+	if attempt <= m.failures && m.early {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	if attempt <= m.failures {
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var lines []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		content, _ := ioutil.ReadAll(part)
+		if part.FileName() == "" {
+			lines = append(lines, fmt.Sprintf("%s=%s", part.FormName(), content))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s=%s|%s|%s", part.FormName(), part.FileName(), part.Header.Get(ContentType), content))
+		}
+	}
+	sort.Strings(lines)
+
+	length := "unknown"
+	if r.ContentLength >= 0 {
+		length = "known"
+	}
+	lines = append(lines, "length="+length)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(strings.Join(lines, "\n")))
+}
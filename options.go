@@ -0,0 +1,240 @@
+package gohttp
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// GoHTTP Default transport parameters.
+const (
+	DefaultTimeout               = 60 * time.Second
+	DefaultDialTimeout           = 10 * time.Second
+	DefaultKeepAlive             = 30 * time.Second
+	DefaultTLSHandshakeTimeout   = 10 * time.Second
+	DefaultResponseHeaderTimeout = 30 * time.Second
+	DefaultExpectContinueTimeout = 1 * time.Second
+	DefaultIdleConnTimeout       = 90 * time.Second
+	DefaultMaxIdleConns          = 100
+	DefaultMaxIdleConnsPerHost   = 10
+)
+
+// Option configures a `gohttp.Client` at construction time.
+type Option func(*clientOptions)
+
+// clientOptions collects the options supplied to NewClient.
+type clientOptions struct {
+	httpClient *http.Client
+	transport  http.RoundTripper
+	timeout    time.Duration
+	dialer     *net.Dialer
+
+	// tune holds the changes to apply to the `http.Transport`.
+	tune []func(*http.Transport)
+
+	// tlsTune holds the changes to apply to the TLS configuration of the
+	// `http.Transport`.
+	tlsTune []func(*tls.Config)
+}
+
+// newClientOptions returns the default options.
+func newClientOptions() *clientOptions {
+	return &clientOptions{
+		timeout: DefaultTimeout,
+		dialer: &net.Dialer{
+			Timeout:   DefaultDialTimeout,
+			KeepAlive: DefaultKeepAlive,
+		},
+	}
+}
+
+// DefaultTransport returns an `http.Transport` with the default GoHTTP
+// transport parameters. Proxies are read from the environment.
+func DefaultTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   DefaultDialTimeout,
+		KeepAlive: DefaultKeepAlive,
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   DefaultTLSHandshakeTimeout,
+		ResponseHeaderTimeout: DefaultResponseHeaderTimeout,
+		ExpectContinueTimeout: DefaultExpectContinueTimeout,
+		IdleConnTimeout:       DefaultIdleConnTimeout,
+		MaxIdleConns:          DefaultMaxIdleConns,
+		MaxIdleConnsPerHost:   DefaultMaxIdleConnsPerHost,
+	}
+}
+
+// build builds the `http.Client` described by the options.
+func (o *clientOptions) build() *http.Client {
+	if o.httpClient != nil {
+		return o.httpClient
+	}
+
+	transport := o.transport
+	if transport == nil {
+		transport = DefaultTransport()
+	}
+
+	// TLS changes are applied last, on top of any base TLS configuration.
+	tune := o.tune
+	if len(o.tlsTune) > 0 {
+		tune = append(tune, func(t *http.Transport) {
+			config := &tls.Config{}
+			if t.TLSClientConfig != nil {
+				config = t.TLSClientConfig.Clone()
+			}
+			for _, tlsTune := range o.tlsTune {
+				tlsTune(config)
+			}
+			t.TLSClientConfig = config
+		})
+	}
+
+	// Transport tuning only applies to an `http.Transport`, which is cloned
+	// so that a transport supplied by the application is left untouched.
+	if t, ok := transport.(*http.Transport); ok && len(tune) > 0 {
+		if o.transport != nil {
+			t = t.Clone()
+		}
+		for _, tune := range tune {
+			tune(t)
+		}
+		transport = t
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   o.timeout,
+	}
+}
+
+//------------------------------------------------------------------------------
+// Client Injection
+//------------------------------------------------------------------------------
+
+// WithHTTPClient makes the client issue its requests with the supplied
+// `http.Client`. All the other transport options are ignored.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *clientOptions) {
+		o.httpClient = client
+	}
+}
+
+// WithTransport makes the client issue its requests through the supplied
+// `http.RoundTripper` instead of the default transport. Transport tuning
+// options only apply if it is an `*http.Transport`.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *clientOptions) {
+		o.transport = transport
+	}
+}
+
+//------------------------------------------------------------------------------
+// Timeouts
+//------------------------------------------------------------------------------
+
+// WithTimeout sets the time limit of a single attempt, including reading the
+// response body. For streamed responses, the limit only applies until the
+// headers arrive, so that long downloads are not cut off. Zero means no limit.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithDialTimeout sets the time limit for establishing a connection.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.dialer.Timeout = timeout
+		o.tune = append(o.tune, func(t *http.Transport) {
+			t.DialContext = o.dialer.DialContext
+		})
+	}
+}
+
+// WithTLSHandshakeTimeout sets the time limit for the TLS handshake.
+func WithTLSHandshakeTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.tune = append(o.tune, func(t *http.Transport) {
+			t.TLSHandshakeTimeout = timeout
+		})
+	}
+}
+
+// WithResponseHeaderTimeout sets the time limit for reading the response
+// headers once the request is written.
+func WithResponseHeaderTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.tune = append(o.tune, func(t *http.Transport) {
+			t.ResponseHeaderTimeout = timeout
+		})
+	}
+}
+
+//------------------------------------------------------------------------------
+// Connection Pooling
+//------------------------------------------------------------------------------
+
+// WithIdleConnTimeout sets how long an idle connection is kept in the pool.
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.tune = append(o.tune, func(t *http.Transport) {
+			t.IdleConnTimeout = timeout
+		})
+	}
+}
+
+// WithMaxIdleConns sets the maximum number of idle connections across all
+// hosts.
+func WithMaxIdleConns(n int) Option {
+	return func(o *clientOptions) {
+		o.tune = append(o.tune, func(t *http.Transport) {
+			t.MaxIdleConns = n
+		})
+	}
+}
+
+// WithMaxIdleConnsPerHost sets the maximum number of idle connections per
+// host.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(o *clientOptions) {
+		o.tune = append(o.tune, func(t *http.Transport) {
+			t.MaxIdleConnsPerHost = n
+		})
+	}
+}
+
+// WithMaxConnsPerHost caps the number of connections per host, including the
+// ones in use. Zero means no limit.
+func WithMaxConnsPerHost(n int) Option {
+	return func(o *clientOptions) {
+		o.tune = append(o.tune, func(t *http.Transport) {
+			t.MaxConnsPerHost = n
+		})
+	}
+}
+
+//------------------------------------------------------------------------------
+// Proxies
+//------------------------------------------------------------------------------
+
+// WithProxy sets the function used to pick the proxy of each request. A nil
+// function disables proxies.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(o *clientOptions) {
+		o.tune = append(o.tune, func(t *http.Transport) {
+			t.Proxy = proxy
+		})
+	}
+}
+
+// WithProxyURL sends every request through the proxy at proxyURL.
+func WithProxyURL(proxyURL *url.URL) Option {
+	return WithProxy(http.ProxyURL(proxyURL))
+}
@@ -0,0 +1,95 @@
+package gohttp
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type OptionsTest struct{}
+
+var _ = check.Suite(&OptionsTest{})
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func (o *OptionsTest) TestDefaultTransport(c *check.C) {
+	client := NewClient("", nil)
+	c.Assert(client.HTTPClient().Timeout, check.Equals, DefaultTimeout)
+
+	transport, ok := client.HTTPClient().Transport.(*http.Transport)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(transport.TLSHandshakeTimeout, check.Equals, DefaultTLSHandshakeTimeout)
+	c.Assert(transport.ResponseHeaderTimeout, check.Equals, DefaultResponseHeaderTimeout)
+	c.Assert(transport.MaxIdleConnsPerHost, check.Equals, DefaultMaxIdleConnsPerHost)
+}
+
+func (o *OptionsTest) TestTransportTuning(c *check.C) {
+	proxyURL, _ := url.Parse("http://proxy.example.com:8080")
+	client := NewClient("", nil,
+		WithTimeout(5*time.Second),
+		WithDialTimeout(time.Second),
+		WithTLSHandshakeTimeout(2*time.Second),
+		WithResponseHeaderTimeout(3*time.Second),
+		WithIdleConnTimeout(4*time.Second),
+		WithMaxIdleConns(7),
+		WithMaxIdleConnsPerHost(3),
+		WithMaxConnsPerHost(5),
+		WithProxyURL(proxyURL),
+	)
+	c.Assert(client.HTTPClient().Timeout, check.Equals, 5*time.Second)
+
+	transport := client.HTTPClient().Transport.(*http.Transport)
+	c.Assert(transport.TLSHandshakeTimeout, check.Equals, 2*time.Second)
+	c.Assert(transport.ResponseHeaderTimeout, check.Equals, 3*time.Second)
+	c.Assert(transport.IdleConnTimeout, check.Equals, 4*time.Second)
+	c.Assert(transport.MaxIdleConns, check.Equals, 7)
+	c.Assert(transport.MaxIdleConnsPerHost, check.Equals, 3)
+	c.Assert(transport.MaxConnsPerHost, check.Equals, 5)
+
+	req, _ := http.NewRequest(GET, "http://api.example.com", nil)
+	proxy, err := transport.Proxy(req)
+	c.Assert(err, check.IsNil)
+	c.Assert(proxy, check.DeepEquals, proxyURL)
+}
+
+func (o *OptionsTest) TestWithHTTPClient(c *check.C) {
+	httpClient := &http.Client{}
+	client := NewClient("", nil, WithHTTPClient(httpClient), WithTimeout(time.Second))
+	c.Assert(client.HTTPClient(), check.Equals, httpClient)
+	c.Assert(httpClient.Timeout, check.Equals, time.Duration(0))
+}
+
+func (o *OptionsTest) TestWithSuppliedTransportIsNotMutated(c *check.C) {
+	transport := &http.Transport{}
+	client := NewClient("", nil, WithTransport(transport), WithMaxIdleConns(7))
+	c.Assert(transport.MaxIdleConns, check.Equals, 0)
+	c.Assert(client.HTTPClient().Transport.(*http.Transport).MaxIdleConns, check.Equals, 7)
+}
+
+func (o *OptionsTest) TestWithRoundTripper(c *check.C) {
+	var sent *http.Request
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		return &http.Response{
+			StatusCode: http.StatusAccepted,
+			Header:     http.Header{},
+			Body:       http.NoBody,
+			Request:    req,
+		}, nil
+	})
+
+	client := NewClient("http://api.example.com", nil, WithTransport(transport))
+	response, err := client.Execute(&Request{
+		Method: GET,
+		URL:    "/users",
+	})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusAccepted)
+	c.Assert(sent.URL.String(), check.Equals, "http://api.example.com/users")
+}
@@ -0,0 +1,176 @@
+package gohttp
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenk/backoff"
+)
+
+// Rate limit header constants.
+const (
+	RetryAfter          = "Retry-After"
+	RateLimitLimit      = "RateLimit-Limit"
+	RateLimitRemaining  = "RateLimit-Remaining"
+	RateLimitReset      = "RateLimit-Reset"
+	XRateLimitLimit     = "X-RateLimit-Limit"
+	XRateLimitRemaining = "X-RateLimit-Remaining"
+	XRateLimitReset     = "X-RateLimit-Reset"
+)
+
+// DefaultMaxRetryAfter is the default cap applied to server provided retry
+// delays.
+const DefaultMaxRetryAfter = 30 * time.Second
+
+// epochThreshold separates reset values expressed as a number of seconds from
+// values expressed as a unix timestamp.
+const epochThreshold = 1000000000
+
+// RateLimitStatus models the rate limiting information advertised by a server
+// through the `Retry-After` and `RateLimit-*` / `X-RateLimit-*` headers.
+type RateLimitStatus struct {
+
+	// Limit is the request quota of the current window, or -1 if not provided.
+	Limit int
+
+	// Remaining is the number of requests left in the current window, or -1
+	// if not provided.
+	Remaining int
+
+	// Reset is the time at which the current window resets. It is the zero
+	// time if not provided.
+	Reset time.Time
+
+	// RetryAfter is the delay requested by the `Retry-After` header.
+	RetryAfter time.Duration
+}
+
+// ParseRateLimitStatus extracts the rate limiting information from a set of
+// response headers. It returns nil if none of the headers are present.
+//
+// `Retry-After` is accepted either as a number of seconds or as an HTTP-date.
+// Reset values are accepted either as a number of seconds or as a unix
+// timestamp.
+func ParseRateLimitStatus(header http.Header, now time.Time) *RateLimitStatus {
+	status := &RateLimitStatus{Limit: -1, Remaining: -1}
+	found := false
+
+	if value := header.Get(RetryAfter); value != "" {
+		if delay, ok := parseRetryAfter(value, now); ok {
+			status.RetryAfter = delay
+			found = true
+		}
+	}
+	if value, ok := parseIntHeader(header, RateLimitLimit, XRateLimitLimit); ok {
+		status.Limit = value
+		found = true
+	}
+	if value, ok := parseIntHeader(header, RateLimitRemaining, XRateLimitRemaining); ok {
+		status.Remaining = value
+		found = true
+	}
+	if value, ok := parseIntHeader(header, RateLimitReset, XRateLimitReset); ok {
+		if value >= epochThreshold {
+			status.Reset = time.Unix(int64(value), 0)
+		} else {
+			status.Reset = now.Add(seconds(value))
+		}
+		found = true
+	}
+
+	if !found {
+		return nil
+	}
+	return status
+}
+
+// Delay returns how long a client should wait before issuing its next request
+// according to the server. It returns zero if the server did not ask for one.
+func (s *RateLimitStatus) Delay(now time.Time) time.Duration {
+	if s == nil {
+		return 0
+	}
+	if s.RetryAfter > 0 {
+		return s.RetryAfter
+	}
+	if s.Remaining == 0 && !s.Reset.IsZero() && s.Reset.After(now) {
+		return s.Reset.Sub(now)
+	}
+	return 0
+}
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if n, err := strconv.Atoi(value); err == nil {
+		if n < 0 {
+			return 0, false
+		}
+		return seconds(n), true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
+
+// seconds converts a number of seconds to a duration, clamped to the longest
+// representable duration instead of overflowing.
+func seconds(n int) time.Duration {
+	if int64(n) > int64(math.MaxInt64/time.Second) {
+		return math.MaxInt64
+	}
+	return time.Duration(n) * time.Second
+}
+
+func parseIntHeader(header http.Header, keys ...string) (int, bool) {
+	for _, key := range keys {
+		value := strings.TrimSpace(header.Get(key))
+		if value == "" {
+			continue
+		}
+		// Some servers send a list of policies, the first one is the active one.
+		if i := strings.IndexAny(value, ",;"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		parsed, err := strconv.Atoi(value)
+		if err == nil && parsed >= 0 {
+			return parsed, true
+		}
+	}
+	return 0, false
+}
+
+//------------------------------------------------------------------------------
+// Server Driven Backoff
+//------------------------------------------------------------------------------
+
+// serverDelayBackOff wraps a backoff.BackOff and substitutes the delay
+// requested by the server, when there is one, for the next computed interval.
+// The wrapped policy still decides when to stop retrying.
+type serverDelayBackOff struct {
+	backoff.BackOff
+	delay time.Duration
+}
+
+func (b *serverDelayBackOff) NextBackOff() time.Duration {
+	next := b.BackOff.NextBackOff()
+	if next == backoff.Stop || b.delay <= 0 {
+		return next
+	}
+
+	delay := b.delay
+	b.delay = 0
+	return delay
+}
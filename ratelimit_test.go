@@ -0,0 +1,79 @@
+package gohttp
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type RateLimitTest struct{}
+
+var _ = check.Suite(&RateLimitTest{})
+
+func (r *RateLimitTest) TestParsingWithoutHeaders(c *check.C) {
+	status := ParseRateLimitStatus(http.Header{}, time.Now())
+	c.Assert(status, check.IsNil)
+}
+
+func (r *RateLimitTest) TestParsingRetryAfterSeconds(c *check.C) {
+	header := http.Header{}
+	header.Set(RetryAfter, "120")
+
+	status := ParseRateLimitStatus(header, time.Now())
+	c.Assert(status, check.NotNil)
+	c.Assert(status.RetryAfter, check.Equals, 2*time.Minute)
+	c.Assert(status.Limit, check.Equals, -1)
+	c.Assert(status.Remaining, check.Equals, -1)
+}
+
+func (r *RateLimitTest) TestParsingHugeRetryAfter(c *check.C) {
+	header := http.Header{}
+	header.Set(RetryAfter, "9999999999999")
+
+	status := ParseRateLimitStatus(header, time.Now())
+	c.Assert(status, check.NotNil)
+	c.Assert(status.RetryAfter, check.Equals, time.Duration(math.MaxInt64))
+}
+
+func (r *RateLimitTest) TestParsingRetryAfterDate(c *check.C) {
+	now := time.Date(2017, time.October, 1, 12, 0, 0, 0, time.UTC)
+	header := http.Header{}
+	header.Set(RetryAfter, now.Add(90*time.Second).Format(http.TimeFormat))
+
+	status := ParseRateLimitStatus(header, now)
+	c.Assert(status, check.NotNil)
+	c.Assert(status.RetryAfter, check.Equals, 90*time.Second)
+}
+
+func (r *RateLimitTest) TestParsingRateLimitHeaders(c *check.C) {
+	now := time.Date(2017, time.October, 1, 12, 0, 0, 0, time.UTC)
+	header := http.Header{}
+	header.Set(RateLimitLimit, "100")
+	header.Set(RateLimitRemaining, "0")
+	header.Set(RateLimitReset, "30")
+
+	status := ParseRateLimitStatus(header, now)
+	c.Assert(status, check.NotNil)
+	c.Assert(status.Limit, check.Equals, 100)
+	c.Assert(status.Remaining, check.Equals, 0)
+	c.Assert(status.Reset, check.Equals, now.Add(30*time.Second))
+	c.Assert(status.Delay(now), check.Equals, 30*time.Second)
+}
+
+func (r *RateLimitTest) TestParsingXRateLimitHeadersWithEpochReset(c *check.C) {
+	now := time.Date(2017, time.October, 1, 12, 0, 0, 0, time.UTC)
+	reset := now.Add(time.Minute)
+	header := http.Header{}
+	header.Set(XRateLimitLimit, "5000")
+	header.Set(XRateLimitRemaining, "4999")
+	header.Set(XRateLimitReset, "1506859260")
+
+	status := ParseRateLimitStatus(header, now)
+	c.Assert(status, check.NotNil)
+	c.Assert(status.Limit, check.Equals, 5000)
+	c.Assert(status.Remaining, check.Equals, 4999)
+	c.Assert(status.Reset.Equal(reset), check.Equals, true)
+	c.Assert(status.Delay(now), check.Equals, time.Duration(0))
+}
@@ -1,8 +1,14 @@
 package gohttp
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 // Request models an HTTP request.
@@ -17,16 +23,65 @@ type Request struct {
 	Header http.Header
 
 	// URL is the route to be used for the request. The URL should be relative to the BaseURL of the client.
+	//
+	// The URL is resolved against the BaseURL as described by RFC 3986, with
+	// the BaseURL treated as a directory: "/users", "users" and "//users" all
+	// resolve below its path, and dot segments are removed. An absolute URL,
+	// such as "https://example.com/users", bypasses the BaseURL, and the
+	// credentials of the client are not sent to another host. The query
+	// strings of the BaseURL and of the URL are kept and merged with the
+	// Params.
+	//
+	// The path of the URL may contain placeholders, such as "/users/{id}",
+	// which are filled with the escaped PathParams of the same name. Braces
+	// in the query are sent as is.
 	URL string
 
+	// PathParams fill the placeholders of the URL.
+	PathParams map[string]string
+
+	// HeaderMerge overrides how the Header of the request is merged with the
+	// Headers of the client. See `HeaderMerge`.
+	HeaderMerge HeaderMerge
+
 	// Params contains the URL parameters to be used with the request.
 	Params []Param
 
-	// Body contains the JSON body to be used for the request. Body will be sent as application/json.
+	// Body contains the body to be used for the request. Body is encoded by
+	// the encoder of its ContentType, and sent as application/json by default.
+	// Byte slices are sent as is, as application/octet-stream by default.
+	//
+	// If Body is a `*Multipart`, it is streamed as multipart/form-data.
+	//
+	// If Body is an `io.Reader` it is sent as is. Unless retries are disabled
+	// for the request, the reader is read into memory up front so the payload
+	// can be resent on every retry, then closed if it is an `io.Closer`. The
+	// reader is consumed, so such a request can only be executed once.
 	Body interface{}
 
 	// Form contains the form to be used for the request. Form will be sent as application/x-www-form-urlencoded.
 	Form interface{}
+
+	// ContentType is the media type of the Body, which selects its encoder
+	// among the encoders of the client and overrides any `Content-Type`
+	// header. When empty, the `Content-Type` header of the request or of the
+	// client is used, if any.
+	ContentType string
+
+	// Backoff optionally overrides the backoff policy of the client for this request.
+	Backoff *BackoffOptions
+
+	// RetryPolicy optionally overrides the retry policy of the client for this request.
+	RetryPolicy RetryPolicy
+
+	// Middleware wraps the execution of the request, inside the middleware of the client.
+	Middleware []Middleware
+
+	// Stream, when true, leaves the body of the response unread in its Stream,
+	// which the caller must close. Retries only apply until the response is
+	// handed off: the streams of retried attempts are discarded, and the body
+	// of a response returned with an error is buffered.
+	Stream bool
 }
 
 // Param holds the key/value pair associated with a parameter on a Request
@@ -42,25 +97,72 @@ type Param struct {
 
 // Translate translates a `gohttp.Request` object into an `http.Request` object.
 func (r *Request) Translate(client *Client) (*http.Request, error) {
-	URL := client.BaseURL + r.URL
+	return r.TranslateContext(context.Background(), client)
+}
+
+// TranslateContext translates a `gohttp.Request` object into an `http.Request`
+// object bound to the supplied `context.Context`.
+func (r *Request) TranslateContext(ctx context.Context, client *Client) (*http.Request, error) {
+	path, err := r.expandPath()
+	if err != nil {
+		return nil, err
+	}
+	URL, err := resolveURL(client.BaseURL, path)
+	if err != nil {
+		return nil, err
+	}
 
-	var err error
 	var req *http.Request
-	if r.Body != nil {
-		// Request with JSON body.
-		req, err = r.requestWithBody(r.Body, r.Method, URL)
+	contentType := r.ContentType
+	if contentType == "" {
+		contentType = r.Header.Get(ContentType)
+	}
+	if contentType == "" {
+		contentType = client.Headers.Get(ContentType)
+	}
+
+	if multipart, ok := r.Body.(*Multipart); ok {
+		// Request with a multipart body, streamed on every attempt.
+		req, err = multipart.request(ctx, r.Method, URL)
+		if err != nil {
+			return nil, err
+		}
+	} else if reader, ok := r.Body.(io.Reader); ok {
+		// Request with a raw body.
+		req, err = r.requestWithReader(ctx, reader, r.Method, URL)
+		if err != nil {
+			return nil, err
+		}
+	} else if r.Body != nil {
+		// Request with an encoded body.
+		if contentType == "" {
+			contentType = MediaTypeJSON
+			if _, ok := r.Body.([]byte); ok {
+				contentType = MediaTypeOctetStream
+			}
+		}
+		encoder, ok := client.encoders().Lookup(contentType)
+		if !ok {
+			return nil, ErrUnsupportedMediaType
+		}
+		req, err = r.requestWithBody(ctx, encoder, r.Body, r.Method, URL)
 		if err != nil {
 			return nil, err
 		}
 	} else if r.Form != nil {
-		// Request with form data.
-		req, err = r.requestWithForm(r.Form, r.Method, URL)
+		// Request with form data, always sent form-urlencoded.
+		contentType = MediaTypeForm
+		encoder, ok := client.encoders().Lookup(MediaTypeForm)
+		if !ok {
+			encoder = FormEncoder
+		}
+		req, err = r.requestWithBody(ctx, encoder, r.Form, r.Method, URL)
 		if err != nil {
 			return nil, err
 		}
 	} else {
 		// Request without data.
-		req, err = http.NewRequest(r.Method, URL, nil)
+		req, err = http.NewRequestWithContext(ctx, r.Method, URL, nil)
 		if err != nil {
 			return nil, err
 		}
@@ -68,10 +170,109 @@ func (r *Request) Translate(client *Client) (*http.Request, error) {
 
 	// Hydrate http.Request with details from gohttp.Request object.
 	r.hydrateRequest(req, client)
+	if multipart, ok := r.Body.(*Multipart); ok {
+		req.Header.Set(ContentType, multipart.ContentType())
+	} else if r.ContentType != "" || (r.Form != nil && r.Body == nil) {
+		// The media type the body was encoded with wins over the headers.
+		req.Header.Set(ContentType, contentType)
+	} else if contentType != "" && req.Header.Get(ContentType) == "" {
+		req.Header.Set(ContentType, contentType)
+	}
 
 	return req, nil
 }
 
+//------------------------------------------------------------------------------
+// URL Resolution
+//------------------------------------------------------------------------------
+
+// resolveURL resolves the URL of a request against the BaseURL of a client.
+// The BaseURL is treated as a directory, so references are resolved below its
+// path however many slashes they start with: only an absolute URL leaves the
+// BaseURL. The query of the BaseURL is kept before the query of the reference.
+func resolveURL(baseURL string, reference string) (string, error) {
+	ref, err := url.Parse(reference)
+	if err != nil {
+		return "", err
+	}
+	if baseURL == "" || ref.IsAbs() {
+		return ref.String(), nil
+	}
+
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if ref.Host != "" {
+		// A network-path reference, such as "//users", is a path.
+		ref, err = url.Parse("/" + strings.TrimLeft(reference, "/"))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	query := joinQuery(base.RawQuery, ref.RawQuery)
+	base.RawQuery, ref.RawQuery = "", ""
+	base.Fragment, base.RawFragment = "", ""
+
+	if ref.Path != "" {
+		// Resolve the path below the directory of the BaseURL.
+		if !strings.HasSuffix(base.Path, "/") {
+			base.Path += "/"
+			if base.RawPath != "" {
+				base.RawPath += "/"
+			}
+		}
+		escaped := strings.TrimLeft(ref.EscapedPath(), "/")
+		ref.Path, err = url.PathUnescape(escaped)
+		if err != nil {
+			return "", err
+		}
+		ref.RawPath = escaped
+	}
+
+	resolved := base.ResolveReference(ref)
+	resolved.RawQuery = query
+	resolved.ForceQuery = false
+	return resolved.String(), nil
+}
+
+// joinQuery joins encoded query strings.
+func joinQuery(queries ...string) string {
+	var parts []string
+	for _, query := range queries {
+		if query != "" {
+			parts = append(parts, query)
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// routePath returns the path of the URL of the request, relative to the
+// BaseURL it is resolved against and without dot segments. Route limits are
+// matched against it.
+func (r *Request) routePath() string {
+	reference, err := r.expandPath()
+	if err != nil {
+		reference = r.URL
+	}
+	ref, err := url.Parse(reference)
+	if err != nil {
+		return ""
+	}
+	if ref.IsAbs() {
+		return ref.Path
+	}
+	if ref.Host != "" {
+		ref, err = url.Parse("/" + strings.TrimLeft(reference, "/"))
+		if err != nil {
+			return ""
+		}
+	}
+	root := &url.URL{Path: "/"}
+	return root.ResolveReference(&url.URL{Path: strings.TrimLeft(ref.Path, "/")}).Path
+}
+
 //------------------------------------------------------------------------------
 // Params
 //------------------------------------------------------------------------------
@@ -85,41 +286,101 @@ func (r *Request) SetParam(key string, value string) {
 	r.Params = append(r.Params, param)
 }
 
+// SetPathParam fills the placeholder name of the URL with value.
+func (r *Request) SetPathParam(name string, value string) {
+	if r.PathParams == nil {
+		r.PathParams = map[string]string{}
+	}
+	r.PathParams[name] = value
+}
+
+//------------------------------------------------------------------------------
+// Body Replay
+//------------------------------------------------------------------------------
+
+// ErrBodyNotReplayable is returned when a request needs to be retried but its
+// body cannot be rebuilt.
+var ErrBodyNotReplayable = errors.New("gohttp: request body cannot be replayed")
+
+// rewindBody re-arms the body of an `http.Request` that has already been
+// sent, so the same payload goes out on the next attempt.
+func rewindBody(req *http.Request) error {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if req.GetBody == nil {
+		return ErrBodyNotReplayable
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	return nil
+}
+
 //------------------------------------------------------------------------------
 // Helpers
 //------------------------------------------------------------------------------
 
-func (r *Request) requestWithBody(body interface{}, method string, url string) (*http.Request, error) {
-	jsonData, err := JSONData(body)
+func (r *Request) requestWithReader(ctx context.Context, reader io.Reader, method string, url string) (*http.Request, error) {
+	if !r.retriesEnabled() {
+		return http.NewRequestWithContext(ctx, method, url, reader)
+	}
+
+	// Spool the reader so the body can be rebuilt for each retry attempt. The
+	// transport never sees the reader, so it is closed here.
+	data, err := ioutil.ReadAll(reader)
+	if closer, ok := reader.(io.Closer); ok {
+		closer.Close()
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return http.NewRequest(method, url, jsonData)
+	return http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
 }
 
-func (r *Request) requestWithForm(form interface{}, method string, url string) (*http.Request, error) {
-	formData, err := FormData(form)
+func (r *Request) requestWithBody(ctx context.Context, encoder Encoder, body interface{}, method string, url string) (*http.Request, error) {
+	data, err := encoder.Encode(body)
 	if err != nil {
 		return nil, err
 	}
 
-	return http.NewRequest(method, url, formData)
+	return http.NewRequestWithContext(ctx, method, url, bytes.NewReader(data))
+}
+
+func (r *Request) retriesEnabled() bool {
+	return r.Backoff == nil || r.Backoff.MaxAttempts != 1
 }
 
 func (r *Request) hydrateRequest(req *http.Request, client *Client) {
-	// Set basic auth if needed.
-	if client.BasicAuth != nil {
-		req.SetBasicAuth(client.BasicAuth.Username, client.BasicAuth.Password)
-	}
+	// Add request parameters to the query string of the URL.
+	req.URL.RawQuery = joinQuery(req.URL.RawQuery, r.paramsForRequest())
 
-	// Add request parameters.
-	if params := r.paramsForRequest(); params != "" {
-		req.URL.RawQuery = params
+	// Add request headers. The headers are a fresh copy, so that headers set
+	// on the http.Request never leak into the client or the request.
+	merge := r.HeaderMerge
+	if merge == HeaderMergeDefault {
+		merge = client.HeaderMerge
+	}
+	// Credentials of the client are only sent to the host of its BaseURL.
+	ownsHost := client.ownsHost(req.URL)
+	headers := client.Headers
+	if !ownsHost {
+		headers = client.foreignHeaders()
+	}
+	req.Header = r.combineClientHeaders(headers, merge)
+	if !ownsHost {
+		return
 	}
 
-	// Add request headers.
-	req.Header = r.combineClientHeaders(client.Headers)
+	// Set basic auth if needed, unless the request carries its own
+	// credentials.
+	if client.BasicAuth != nil && req.Header.Get(Authorization) == "" {
+		req.SetBasicAuth(client.BasicAuth.Username, client.BasicAuth.Password)
+	}
 }
 
 func (r *Request) paramsForRequest() string {
@@ -130,17 +391,68 @@ func (r *Request) paramsForRequest() string {
 	return values.Encode()
 }
 
-func (r *Request) combineClientHeaders(headers http.Header) http.Header {
-	if r.Header == nil {
-		r.Header = headers
-	} else {
-		for key, values := range headers {
-			if len(r.Header.Get(key)) == 0 {
-				for _, headerValue := range values {
-					r.Header.Add(key, headerValue)
-				}
-			}
+// combineClientHeaders merges the headers of the client and of the request
+// into a new `http.Header`, leaving both untouched.
+func (r *Request) combineClientHeaders(headers http.Header, merge HeaderMerge) http.Header {
+	return MergeHeaders(headers, r.Header, merge)
+}
+
+//------------------------------------------------------------------------------
+// Headers
+//------------------------------------------------------------------------------
+
+// HeaderMerge controls how the headers of a request are merged with the
+// headers of the client when both set the same header.
+type HeaderMerge int
+
+// Header merge modes.
+const (
+	// HeaderMergeDefault uses the mode of the client for a request, and
+	// HeaderReplace for a client.
+	HeaderMergeDefault HeaderMerge = iota
+
+	// HeaderReplace sends the values of the request instead of the values of
+	// the client.
+	HeaderReplace
+
+	// HeaderAppend sends the values of the client followed by the values of
+	// the request. Headers that only take a single value are still replaced.
+	HeaderAppend
+)
+
+// singleValuedHeaders are replaced rather than appended with HeaderAppend, as
+// a second value would make the request ambiguous or invalid.
+var singleValuedHeaders = map[string]bool{
+	Authorization:    true,
+	ContentType:      true,
+	"Content-Length": true,
+	"Host":           true,
+}
+
+// MergeHeaders returns a new `http.Header` holding the headers of base and
+// override, with canonical keys. When both set the same header, the values of
+// override replace the values of base, or are appended to them with
+// HeaderAppend unless the header is single-valued. Neither base nor override
+// is modified.
+func MergeHeaders(base http.Header, override http.Header, merge HeaderMerge) http.Header {
+	merged := make(http.Header, len(base)+len(override))
+	for key, values := range base {
+		key = http.CanonicalHeaderKey(key)
+		merged[key] = append(merged[key], values...)
+	}
+
+	// Keys differing only by case are collected before being merged.
+	overrides := make(http.Header, len(override))
+	for key, values := range override {
+		key = http.CanonicalHeaderKey(key)
+		overrides[key] = append(overrides[key], values...)
+	}
+	for key, values := range overrides {
+		if merge == HeaderAppend && !singleValuedHeaders[key] {
+			merged[key] = append(merged[key], values...)
+		} else {
+			merged[key] = values
 		}
 	}
-	return r.Header
+	return merged
 }
@@ -1,8 +1,14 @@
 package gohttp
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"gopkg.in/check.v1"
 )
@@ -35,7 +41,7 @@ func (r *RequestTest) TestTransalatingJSONRequest(c *check.C) {
 	c.Assert(translated.Method, check.Equals, method)
 	c.Assert(translated.URL.Path, check.Equals, url)
 	c.Assert(translated.URL.RawQuery, check.Equals, fmt.Sprintf("%v=%v", "test", "params"))
-	c.Assert(translated.Header, check.DeepEquals, header)
+	c.Assert(translated.Header, check.DeepEquals, http.Header{ContentType: {MediaTypeForm}})
 }
 
 func (r *RequestTest) TestTransalatingFormRequest(c *check.C) {
@@ -63,7 +69,7 @@ func (r *RequestTest) TestTransalatingFormRequest(c *check.C) {
 	c.Assert(translated.Method, check.Equals, method)
 	c.Assert(translated.URL.Path, check.Equals, url)
 	c.Assert(translated.URL.RawQuery, check.Equals, fmt.Sprintf("%v=%v", "test", "params"))
-	c.Assert(translated.Header, check.DeepEquals, header)
+	c.Assert(translated.Header, check.DeepEquals, http.Header{ContentType: {MediaTypeForm}})
 }
 
 func (r *RequestTest) TestTransalatingRequestWithBasicAuth(c *check.C) {
@@ -90,7 +96,7 @@ func (r *RequestTest) TestRequestWithJSONBody(c *check.C) {
 	body := map[string]interface{}{"test": "body"}
 
 	request := Request{}
-	goRequest, err := request.requestWithBody(body, method, url)
+	goRequest, err := request.requestWithBody(context.Background(), JSONEncoder, body, method, url)
 	c.Assert(err, check.Equals, nil)
 	c.Assert(goRequest.Method, check.Equals, method)
 	c.Assert(goRequest.URL.Path, check.Equals, url)
@@ -102,7 +108,7 @@ func (r *RequestTest) TestRequestWithFormData(c *check.C) {
 	form := map[string]interface{}{"test": "body"}
 
 	request := Request{}
-	goRequest, err := request.requestWithForm(form, method, url)
+	goRequest, err := request.requestWithBody(context.Background(), FormEncoder, form, method, url)
 	c.Assert(err, check.Equals, nil)
 	c.Assert(goRequest.Method, check.Equals, method)
 	c.Assert(goRequest.URL.Path, check.Equals, url)
@@ -118,7 +124,304 @@ func (r *RequestTest) TestCombiningHeaders(c *check.C) {
 		Header: requestHeader,
 	}
 
-	combined := request.combineClientHeaders(header)
+	combined := request.combineClientHeaders(header, HeaderReplace)
 	c.Assert(combined.Get(ContentType), check.NotNil)
 	c.Assert(combined.Get(Accept), check.NotNil)
 }
+
+func (r *RequestTest) TestRequestWithReaderBodyIsSpooled(c *check.C) {
+	request := Request{
+		Method: POST,
+		URL:    "api.google.com",
+		Body:   strings.NewReader("payload"),
+	}
+	translated, err := request.Translate(NewClient("", nil))
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.GetBody, check.NotNil)
+	c.Assert(translated.ContentLength, check.Equals, int64(len("payload")))
+}
+
+func (r *RequestTest) TestRequestWithReaderBodyIsClosedOnceSpooled(c *check.C) {
+	path := filepath.Join(c.MkDir(), "payload")
+	c.Assert(ioutil.WriteFile(path, []byte("payload"), 0600), check.IsNil)
+	file, err := os.Open(path)
+	c.Assert(err, check.IsNil)
+
+	request := Request{Method: POST, URL: "api.google.com", Body: file}
+	translated, err := request.Translate(NewClient("", nil))
+	c.Assert(err, check.IsNil)
+	body, _ := ioutil.ReadAll(translated.Body)
+	c.Assert(string(body), check.Equals, "payload")
+	_, err = file.Read(make([]byte, 1))
+	c.Assert(errors.Is(err, os.ErrClosed), check.Equals, true)
+}
+
+func (r *RequestTest) TestRequestWithReaderBodyWithoutRetries(c *check.C) {
+	request := Request{
+		Method:  POST,
+		URL:     "api.google.com",
+		Body:    strings.NewReader("payload"),
+		Backoff: &BackoffOptions{MaxAttempts: 1},
+	}
+	translated, err := request.Translate(NewClient("", nil))
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.Body, check.NotNil)
+}
+
+func (r *RequestTest) TestTranslatingSetsContentType(c *check.C) {
+	client := NewClient("", nil)
+	tests := []struct {
+		request     Request
+		contentType string
+		body        string
+	}{
+		{Request{Body: map[string]interface{}{"a": 1}}, "application/json", `{"a":1}`},
+		{Request{Form: map[string]interface{}{"a": 1}}, "application/x-www-form-urlencoded", "a=1"},
+		{Request{Body: []byte("raw")}, "application/octet-stream", "raw"},
+		{Request{Body: "text", ContentType: "text/plain; charset=utf-8"}, "text/plain; charset=utf-8", "text"},
+		{Request{Body: strings.NewReader("<a/>"), ContentType: "application/xml"}, "application/xml", "<a/>"},
+		{Request{Body: map[string]interface{}{"a": 1}, Header: http.Header{ContentType: {"application/vnd.api+json"}}}, "application/vnd.api+json", `{"a":1}`},
+	}
+	for _, test := range tests {
+		test.request.Method = POST
+		translated, err := test.request.Translate(client)
+		c.Assert(err, check.IsNil)
+		c.Assert(translated.Header.Get(ContentType), check.Equals, test.contentType)
+		c.Assert(translated.ContentLength, check.Equals, int64(len(test.body)))
+		body, _ := ioutil.ReadAll(translated.Body)
+		c.Assert(string(body), check.Equals, test.body)
+	}
+}
+
+func (r *RequestTest) TestTranslatingWithCustomEncoder(c *check.C) {
+	client := NewClient("", nil)
+	request := Request{Method: POST, Body: []string{"a", "b"}, ContentType: "text/csv"}
+	_, err := request.Translate(client)
+	c.Assert(err, check.Equals, ErrUnsupportedMediaType)
+
+	client.RegisterEncoder("text/csv", EncoderFunc(func(v interface{}) ([]byte, error) {
+		return []byte(strings.Join(v.([]string), ",")), nil
+	}))
+	translated, err := request.Translate(client)
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.Header.Get(ContentType), check.Equals, "text/csv")
+	body, _ := ioutil.ReadAll(translated.Body)
+	c.Assert(string(body), check.Equals, "a,b")
+}
+
+func (r *RequestTest) TestTranslatingPrefersRequestContentType(c *check.C) {
+	client := NewClient("", http.Header{ContentType: {"application/json"}})
+	request := Request{Method: POST, Body: "<a/>", ContentType: "text/plain"}
+	translated, err := request.Translate(client)
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.Header[ContentType], check.DeepEquals, []string{"text/plain"})
+	body, _ := ioutil.ReadAll(translated.Body)
+	c.Assert(string(body), check.Equals, "<a/>")
+
+	request.Header = http.Header{ContentType: {"application/xml"}}
+	translated, err = request.Translate(client)
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.Header[ContentType], check.DeepEquals, []string{"text/plain"})
+}
+
+func (r *RequestTest) TestTranslatingFormWithCustomEncoders(c *check.C) {
+	client := NewClient("", http.Header{ContentType: {"application/json"}})
+	client.Encoders = Encoders{MediaTypeJSON: JSONEncoder}
+	request := Request{Method: POST, Form: map[string]interface{}{"a": 1}}
+	translated, err := request.Translate(client)
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.Header.Get(ContentType), check.Equals, MediaTypeForm)
+	body, _ := ioutil.ReadAll(translated.Body)
+	c.Assert(string(body), check.Equals, "a=1")
+}
+
+func (r *RequestTest) TestTranslatingDoesNotLeakContentType(c *check.C) {
+	client := NewClient("", http.Header{Accept: {"application/json"}})
+	request := Request{Method: POST, Body: map[string]interface{}{"a": 1}}
+	_, err := request.Translate(client)
+	c.Assert(err, check.IsNil)
+	c.Assert(client.Headers.Get(ContentType), check.Equals, "")
+}
+
+func (r *RequestTest) TestResolvingURLs(c *check.C) {
+	tests := []struct {
+		baseURL  string
+		url      string
+		params   []Param
+		expected string
+	}{
+		// Joining paths.
+		{"https://api.example.com", "/users", nil, "https://api.example.com/users"},
+		{"https://api.example.com", "users", nil, "https://api.example.com/users"},
+		{"https://api.example.com/", "/users", nil, "https://api.example.com/users"},
+		{"https://api.example.com/v1", "/users", nil, "https://api.example.com/v1/users"},
+		{"https://api.example.com/v1/", "/users", nil, "https://api.example.com/v1/users"},
+		{"https://api.example.com/v1/", "users/", nil, "https://api.example.com/v1/users/"},
+		{"https://api.example.com/v1", "//users", nil, "https://api.example.com/v1/users"},
+		{"https://api.example.com/v1", "", nil, "https://api.example.com/v1"},
+		{"https://api.example.com:8443/v1", "/users", nil, "https://api.example.com:8443/v1/users"},
+
+		// Dot segments.
+		{"https://api.example.com/v1/", "./users", nil, "https://api.example.com/v1/users"},
+		{"https://api.example.com/v1/", "../v2/users", nil, "https://api.example.com/v2/users"},
+		{"https://api.example.com/v1/", "users/../groups", nil, "https://api.example.com/v1/groups"},
+
+		// Escaping.
+		{"https://api.example.com/v1", "/files/a%2Fb", nil, "https://api.example.com/v1/files/a%2Fb"},
+		{"https://api.example.com/my%20api", "/users", nil, "https://api.example.com/my%20api/users"},
+
+		// Absolute and network-path references.
+		{"https://api.example.com/v1?key=1", "https://other.example.com/users?a=1", nil, "https://other.example.com/users?a=1"},
+		{"https://api.example.com/v1", "//cdn.example.com/assets", nil, "https://api.example.com/v1/cdn.example.com/assets"},
+		{"", "https://other.example.com/users", nil, "https://other.example.com/users"},
+
+		// Query merging.
+		{"https://api.example.com/v1?key=secret", "/users", nil, "https://api.example.com/v1/users?key=secret"},
+		{"https://api.example.com/v1", "/users?page=2", nil, "https://api.example.com/v1/users?page=2"},
+		{"https://api.example.com/v1?key=secret", "/users?page=2", nil, "https://api.example.com/v1/users?key=secret&page=2"},
+		{"https://api.example.com/v1?key=secret", "?page=2", nil, "https://api.example.com/v1?key=secret&page=2"},
+		{"https://api.example.com/v1", "/users?page=2", []Param{{Key: "limit", Value: "10"}}, "https://api.example.com/v1/users?page=2&limit=10"},
+		{"https://api.example.com/v1?key=secret", "/users", []Param{{Key: "q", Value: "a b"}}, "https://api.example.com/v1/users?key=secret&q=a+b"},
+		{"https://api.example.com/v1", "/users?tag=a&tag=b", []Param{{Key: "tag", Value: "c"}}, "https://api.example.com/v1/users?tag=a&tag=b&tag=c"},
+		{"https://api.example.com/v1", "/users#section", nil, "https://api.example.com/v1/users#section"},
+	}
+	for _, test := range tests {
+		request := Request{Method: GET, URL: test.url, Params: test.params}
+		translated, err := request.Translate(NewClient(test.baseURL, nil))
+		comment := check.Commentf("%q + %q", test.baseURL, test.url)
+		c.Assert(err, check.IsNil, comment)
+		c.Assert(translated.URL.String(), check.Equals, test.expected, comment)
+	}
+}
+
+func (r *RequestTest) TestResolvingInvalidURLs(c *check.C) {
+	request := Request{Method: GET, URL: "/users"}
+	_, err := request.Translate(NewClient("http://[::1", nil))
+	c.Assert(err, check.NotNil)
+
+	request = Request{Method: GET, URL: "%zz"}
+	_, err = request.Translate(NewClient("https://api.example.com", nil))
+	c.Assert(err, check.NotNil)
+}
+
+func (r *RequestTest) TestTranslatingLeavesHeadersUnmodified(c *check.C) {
+	client := NewClient("https://api.example.com", http.Header{Accept: {"application/json"}, "X-Client": {"a"}})
+	client.SetBasicAuth("user", "pass")
+	request := Request{Method: POST, URL: "/users", Body: map[string]interface{}{"a": 1}, Header: http.Header{"X-Request": {"b"}}}
+
+	clientHeaders := client.Headers.Clone()
+	requestHeaders := request.Header.Clone()
+
+	translated, err := request.Translate(client)
+	c.Assert(err, check.IsNil)
+	translated.Header.Set("X-Client", "mutated")
+	translated.Header.Add("X-Request", "mutated")
+	translated.Header.Set("X-New", "mutated")
+
+	c.Assert(client.Headers, check.DeepEquals, clientHeaders)
+	c.Assert(request.Header, check.DeepEquals, requestHeaders)
+
+	// Requests without headers do not share the map of the client.
+	request = Request{Method: GET, URL: "/users"}
+	translated, err = request.Translate(client)
+	c.Assert(err, check.IsNil)
+	translated.Header.Set(Accept, "text/plain")
+	c.Assert(request.Header, check.IsNil)
+	c.Assert(client.Headers, check.DeepEquals, clientHeaders)
+
+	second, err := request.Translate(client)
+	c.Assert(err, check.IsNil)
+	c.Assert(second.Header.Get(Accept), check.Equals, "application/json")
+	c.Assert(second.Header.Get(Authorization), check.Equals, "Basic dXNlcjpwYXNz")
+}
+
+func (r *RequestTest) TestTranslatingConcurrentlyLeavesHeadersUnmodified(c *check.C) {
+	client := NewClient("https://api.example.com", http.Header{Accept: {"application/json"}})
+	client.SetBasicAuth("user", "pass")
+
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			request := Request{Method: GET, URL: "/users"}
+			translated, err := request.Translate(client)
+			if err == nil {
+				translated.Header.Set(fmt.Sprintf("X-Request-%d", i), "value")
+			}
+			done <- err
+		}(i)
+	}
+	for i := 0; i < 8; i++ {
+		c.Assert(<-done, check.IsNil)
+	}
+	c.Assert(client.Headers, check.DeepEquals, http.Header{Accept: {"application/json"}})
+}
+
+func (r *RequestTest) TestHeaderPrecedence(c *check.C) {
+	client := NewClient("", http.Header{Accept: {"application/json"}, "X-Tag": {"client"}})
+	client.SetBasicAuth("user", "pass")
+	request := Request{
+		Method: GET,
+		Header: http.Header{"x-tag": {"request"}, Authorization: {"Bearer token"}},
+	}
+
+	translated, err := request.Translate(client)
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.Header, check.DeepEquals, http.Header{
+		Accept:        {"application/json"},
+		"X-Tag":       {"request"},
+		Authorization: {"Bearer token"},
+	})
+
+	client.HeaderMerge = HeaderAppend
+	translated, err = request.Translate(client)
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.Header["X-Tag"], check.DeepEquals, []string{"client", "request"})
+
+	request.HeaderMerge = HeaderReplace
+	translated, err = request.Translate(client)
+	c.Assert(err, check.IsNil)
+	c.Assert(translated.Header["X-Tag"], check.DeepEquals, []string{"request"})
+}
+
+func (r *RequestTest) TestMergeHeaders(c *check.C) {
+	base := http.Header{"X-A": {"1"}, "X-B": {"2"}}
+	override := http.Header{"X-B": {"3"}, "x-c": {"4"}, "X-C": {"5"}}
+
+	merged := MergeHeaders(base, override, HeaderReplace)
+	c.Assert(merged["X-A"], check.DeepEquals, []string{"1"})
+	c.Assert(merged["X-B"], check.DeepEquals, []string{"3"})
+	c.Assert(merged["X-C"], check.HasLen, 2)
+
+	merged = MergeHeaders(base, override, HeaderAppend)
+	c.Assert(merged["X-B"], check.DeepEquals, []string{"2", "3"})
+
+	merged["X-A"][0] = "mutated"
+	c.Assert(base, check.DeepEquals, http.Header{"X-A": {"1"}, "X-B": {"2"}})
+	c.Assert(MergeHeaders(nil, nil, HeaderReplace), check.DeepEquals, http.Header{})
+}
+
+func (r *RequestTest) TestMergeHeadersReplacesSingleValuedHeaders(c *check.C) {
+	base := http.Header{
+		Authorization:    {"Bearer client"},
+		ContentType:      {"application/json"},
+		"Content-Length": {"2"},
+		"Host":           {"api.example.com"},
+		"X-Tag":          {"client"},
+	}
+	override := http.Header{
+		"authorization":  {"Bearer request"},
+		ContentType:      {"application/xml"},
+		"Content-Length": {"4"},
+		"Host":           {"other.example.com"},
+		"X-Tag":          {"request"},
+	}
+
+	merged := MergeHeaders(base, override, HeaderAppend)
+	c.Assert(merged, check.DeepEquals, http.Header{
+		Authorization:    {"Bearer request"},
+		ContentType:      {"application/xml"},
+		"Content-Length": {"4"},
+		"Host":           {"other.example.com"},
+		"X-Tag":          {"client", "request"},
+	})
+}
@@ -1,11 +1,11 @@
 package gohttp
 
 import (
-	"bytes"
-	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
-	"strings"
+	"time"
 )
 
 // Response models a response from HTTP request.
@@ -17,52 +17,129 @@ type Response struct {
 	// Code is the response code for the request.
 	Code int
 
+	// Header contains the response headers.
+	Header http.Header
+
+	// RateLimit contains the rate limiting information advertised by the
+	// server, or nil if the response carried none.
+	RateLimit *RateLimitStatus
+
 	// Data contains the raw response data from an request.
 	Data []byte
 
 	// Body is the deserialized response body returned from an request.
 	Body interface{}
 
+	// Stream is the unread response body of a request executed in streaming
+	// mode. The caller must close it, or call Close, once done. It is nil
+	// for buffered responses.
+	Stream io.ReadCloser
+
 	// Error is an error that may have occurred during the request.
 	Error error
 
 	// Request is the gohttp.Request object used to generate the response.
 	Request *Request
+
+	// decoders decode the body of the response. When nil, the default
+	// decoders are used.
+	decoders Decoders
 }
 
+// ErrResponseTooLarge is returned when a buffered response body exceeds the
+// maximum size allowed by the client.
+var ErrResponseTooLarge = errors.New("gohttp: response body too large")
+
 // NewResponse builds a `gohttp.Response` object from an `http.Response` object.
+// The body of a response to a HEAD request is never read.
 func NewResponse(resp *http.Response) (*Response, error) {
-	bodyContent, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+	response := newStreamingResponse(resp, nil)
+	if err := response.buffer(0); err != nil {
 		return nil, err
 	}
+	return response, nil
+}
+
+// newStreamingResponse builds a `gohttp.Response` object whose body is left
+// unread in Stream.
+func newStreamingResponse(resp *http.Response, decoders Decoders) *Response {
+	response := &Response{
+		Code:      resp.StatusCode,
+		Header:    resp.Header,
+		RateLimit: ParseRateLimitStatus(resp.Header, time.Now()),
+		Stream:    resp.Body,
+		decoders:  decoders,
+	}
+	if resp.Request != nil && resp.Request.Method == HEAD {
+		response.Close()
+	}
+	return response
+}
+
+// buffer reads and closes the Stream of the response, then decodes its
+// content into Body according to its `Content-Type`. A positive maxSize caps
+// the size of the body.
+func (r *Response) buffer(maxSize int64) error {
+	if r.Stream == nil {
+		return nil
+	}
+	defer r.Close()
+
+	var reader io.Reader = r.Stream
+	if maxSize > 0 {
+		reader = io.LimitReader(r.Stream, maxSize+1)
+	}
+	bodyContent, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if maxSize > 0 && int64(len(bodyContent)) > maxSize {
+		return ErrResponseTooLarge
+	}
 
 	var body interface{}
-	if len(bodyContent) > 0 {
-		canonicalHeaderKey := http.CanonicalHeaderKey(ContentType)
-		for _, headerVal := range resp.Header[canonicalHeaderKey] {
-			if strings.Contains(headerVal, "application/json") {
-				body, err = ParseJSON(bytes.NewReader(bodyContent))
-				if err != nil {
-					return nil, err
-				}
-				break
-			}
-		}
-		// Set body w/ no conversion if is still nil
-		if body == nil {
-			body = resp.Body
+	if decoder, ok := r.decoder(); ok && len(bodyContent) > 0 {
+		err = decoder.Decode(bodyContent, &body)
+		if err != nil && err != ErrUnsupportedTarget {
+			return err
 		}
 	}
 
-	return &Response{
-		Code: resp.StatusCode,
-		Body: body,
-		Data: bodyContent,
-	}, nil
+	r.Body = body
+	r.Data = bodyContent
+	return nil
 }
 
-// Unmarshal unmarshalls response data to a struct.
+// Close closes the Stream of a streamed response. It is a no-op for buffered
+// responses.
+func (r *Response) Close() error {
+	if r.Stream == nil {
+		return nil
+	}
+	stream := r.Stream
+	r.Stream = nil
+	return stream.Close()
+}
+
+// Unmarshal unmarshalls response data to a struct, with the decoder matching
+// the `Content-Type` of the response. Responses without a `Content-Type` are
+// decoded as JSON.
 func (r *Response) Unmarshal(i interface{}) error {
-	return json.Unmarshal(r.Data, i)
+	if r.Header.Get(ContentType) == "" {
+		return JSONDecoder.Decode(r.Data, i)
+	}
+	decoder, ok := r.decoder()
+	if !ok {
+		return ErrUnsupportedMediaType
+	}
+	return decoder.Decode(r.Data, i)
+}
+
+// decoder returns the decoder matching the `Content-Type` of the response.
+func (r *Response) decoder() (Decoder, bool) {
+	decoders := r.decoders
+	if decoders == nil {
+		decoders = defaultDecoders
+	}
+	return decoders.Lookup(r.Header.Get(ContentType))
 }
@@ -2,8 +2,10 @@ package gohttp
 
 import (
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 
 	"gopkg.in/check.v1"
 )
@@ -27,3 +29,44 @@ func (r *ResponseTest) TestBuildingResponseWithJSON(c *check.C) {
 	c.Assert(response.Body, check.DeepEquals, map[string]interface{}{"test": "test"})
 	c.Assert(response.Code, check.Equals, http.StatusCreated)
 }
+
+func (r *ResponseTest) TestBuildingResponseWithText(c *check.C) {
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{ContentType: {"text/plain; charset=utf-8"}},
+		Body:       ioutil.NopCloser(strings.NewReader("hello")),
+	}
+	response, err := NewResponse(res)
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Body, check.Equals, "hello")
+	c.Assert(string(response.Data), check.Equals, "hello")
+}
+
+func (r *ResponseTest) TestBuildingResponseWithUnknownType(c *check.C) {
+	res := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{ContentType: {"application/octet-stream"}},
+		Body:       ioutil.NopCloser(strings.NewReader("\x00\x01")),
+	}
+	response, err := NewResponse(res)
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Body, check.IsNil)
+	c.Assert(response.Data, check.DeepEquals, []byte("\x00\x01"))
+}
+
+func (r *ResponseTest) TestUnmarshalByContentType(c *check.C) {
+	var user struct {
+		Name string `json:"name" xml:"name"`
+	}
+
+	response := &Response{Header: http.Header{ContentType: {"application/xml"}}, Data: []byte("<user><name>test</name></user>")}
+	c.Assert(response.Unmarshal(&user), check.IsNil)
+	c.Assert(user.Name, check.Equals, "test")
+
+	response = &Response{Header: http.Header{}, Data: []byte(`{"name":"json"}`)}
+	c.Assert(response.Unmarshal(&user), check.IsNil)
+	c.Assert(user.Name, check.Equals, "json")
+
+	response = &Response{Header: http.Header{ContentType: {"image/png"}}, Data: []byte("png")}
+	c.Assert(response.Unmarshal(&user), check.Equals, ErrUnsupportedMediaType)
+}
@@ -0,0 +1,138 @@
+package gohttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// RetryPolicy decides whether a request should be retried.
+//
+// ShouldRetry is called after every attempt with the 1-based number of the
+// attempt that just completed, the `http.Request` that was sent and either
+// the parsed `gohttp.Response` or the transport error returned by the
+// underlying `http.Client`. The backoff policy still decides how long to wait
+// and when to give up.
+type RetryPolicy interface {
+	ShouldRetry(attempt int, req *http.Request, resp *Response, err error) bool
+}
+
+// RetryPolicyFunc is an adapter to allow the use of ordinary functions as
+// a RetryPolicy.
+type RetryPolicyFunc func(attempt int, req *http.Request, resp *Response, err error) bool
+
+// ShouldRetry calls f(attempt, req, resp, err).
+func (f RetryPolicyFunc) ShouldRetry(attempt int, req *http.Request, resp *Response, err error) bool {
+	return f(attempt, req, resp, err)
+}
+
+//------------------------------------------------------------------------------
+// Built In Policies
+//------------------------------------------------------------------------------
+
+// RetryOnStatusCodes retries responses whose status code is one of codes.
+func RetryOnStatusCodes(codes ...int) RetryPolicy {
+	return RetryPolicyFunc(func(attempt int, req *http.Request, resp *Response, err error) bool {
+		if resp == nil {
+			return false
+		}
+		for _, code := range codes {
+			if code == resp.Code {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// RetryOnNetworkErrors retries transport errors such as timeouts, refused or
+// reset connections and connections closed mid response. Other failures,
+// such as DNS errors or unreachable networks, and errors caused by the
+// cancellation of the request context are never retried.
+func RetryOnNetworkErrors() RetryPolicy {
+	return RetryPolicyFunc(func(attempt int, req *http.Request, resp *Response, err error) bool {
+		return isNetworkError(err)
+	})
+}
+
+// RetryIdempotentOnly restricts policy to requests whose method is idempotent
+// (GET, HEAD, OPTIONS, TRACE, PUT and DELETE).
+func RetryIdempotentOnly(policy RetryPolicy) RetryPolicy {
+	return RetryPolicyFunc(func(attempt int, req *http.Request, resp *Response, err error) bool {
+		return isIdempotent(req.Method) && policy.ShouldRetry(attempt, req, resp, err)
+	})
+}
+
+// AnyRetryPolicy retries when at least one of policies asks for a retry.
+func AnyRetryPolicy(policies ...RetryPolicy) RetryPolicy {
+	return RetryPolicyFunc(func(attempt int, req *http.Request, resp *Response, err error) bool {
+		for _, policy := range policies {
+			if policy != nil && policy.ShouldRetry(attempt, req, resp, err) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// AllRetryPolicy retries only when every one of policies asks for a retry.
+func AllRetryPolicy(policies ...RetryPolicy) RetryPolicy {
+	return RetryPolicyFunc(func(attempt int, req *http.Request, resp *Response, err error) bool {
+		for _, policy := range policies {
+			if policy != nil && !policy.ShouldRetry(attempt, req, resp, err) {
+				return false
+			}
+		}
+		return len(policies) > 0
+	})
+}
+
+// DefaultRetryPolicy returns the policy used by a `gohttp.Client` that has no
+// RetryPolicy configured: responses with one of codes are retried, as are
+// network errors on idempotent requests.
+func DefaultRetryPolicy(codes ...int) RetryPolicy {
+	return AnyRetryPolicy(
+		RetryOnStatusCodes(codes...),
+		RetryIdempotentOnly(RetryOnNetworkErrors()),
+	)
+}
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+func isNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	switch {
+	case errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.EPIPE),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	return false
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
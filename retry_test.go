@@ -0,0 +1,94 @@
+package gohttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"syscall"
+
+	"gopkg.in/check.v1"
+)
+
+type RetryTest struct{}
+
+var _ = check.Suite(&RetryTest{})
+
+func (r *RetryTest) TestRetryOnStatusCodes(c *check.C) {
+	req, _ := http.NewRequest(GET, "http://example.com", nil)
+	policy := RetryOnStatusCodes(429, 500)
+	c.Assert(policy.ShouldRetry(1, req, &Response{Code: 500}, nil), check.Equals, true)
+	c.Assert(policy.ShouldRetry(1, req, &Response{Code: 404}, nil), check.Equals, false)
+	c.Assert(policy.ShouldRetry(1, req, nil, io.EOF), check.Equals, false)
+}
+
+func (r *RetryTest) TestRetryOnNetworkErrors(c *check.C) {
+	req, _ := http.NewRequest(GET, "http://example.com", nil)
+	policy := RetryOnNetworkErrors()
+	reset := &url.Error{Op: "Get", URL: "http://example.com", Err: syscall.ECONNRESET}
+	canceled := &url.Error{Op: "Get", URL: "http://example.com", Err: context.Canceled}
+	c.Assert(policy.ShouldRetry(1, req, nil, reset), check.Equals, true)
+	c.Assert(policy.ShouldRetry(1, req, nil, io.ErrUnexpectedEOF), check.Equals, true)
+	c.Assert(policy.ShouldRetry(1, req, nil, canceled), check.Equals, false)
+	c.Assert(policy.ShouldRetry(1, req, nil, errors.New("unknown")), check.Equals, false)
+	c.Assert(policy.ShouldRetry(1, req, &Response{Code: 500}, nil), check.Equals, false)
+}
+
+func (r *RetryTest) TestRetryOnNetworkErrorsNarrowsOpErrors(c *check.C) {
+	req, _ := http.NewRequest(POST, "http://example.com", nil)
+	policy := RetryOnNetworkErrors()
+
+	refused := &url.Error{Op: "Post", URL: "http://example.com", Err: &net.OpError{
+		Op:  "dial",
+		Net: "tcp",
+		Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+	}}
+	timeout := &url.Error{Op: "Post", URL: "http://example.com", Err: &net.OpError{
+		Op:  "read",
+		Net: "tcp",
+		Err: &net.DNSError{Err: "i/o timeout", IsTimeout: true},
+	}}
+	lookup := &url.Error{Op: "Post", URL: "http://example.com", Err: &net.OpError{
+		Op:  "dial",
+		Net: "tcp",
+		Err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true},
+	}}
+	unreachable := &url.Error{Op: "Post", URL: "http://example.com", Err: &net.OpError{
+		Op:  "dial",
+		Net: "tcp",
+		Err: os.NewSyscallError("connect", syscall.ENETUNREACH),
+	}}
+
+	c.Assert(policy.ShouldRetry(1, req, nil, refused), check.Equals, true)
+	c.Assert(policy.ShouldRetry(1, req, nil, timeout), check.Equals, true)
+	c.Assert(policy.ShouldRetry(1, req, nil, lookup), check.Equals, false)
+	c.Assert(policy.ShouldRetry(1, req, nil, unreachable), check.Equals, false)
+}
+
+func (r *RetryTest) TestRetryIdempotentOnly(c *check.C) {
+	get, _ := http.NewRequest(GET, "http://example.com", nil)
+	post, _ := http.NewRequest(POST, "http://example.com", nil)
+	policy := RetryIdempotentOnly(RetryOnStatusCodes(500))
+	c.Assert(policy.ShouldRetry(1, get, &Response{Code: 500}, nil), check.Equals, true)
+	c.Assert(policy.ShouldRetry(1, post, &Response{Code: 500}, nil), check.Equals, false)
+}
+
+func (r *RetryTest) TestComposingPolicies(c *check.C) {
+	req, _ := http.NewRequest(GET, "http://example.com", nil)
+	firstAttempt := RetryPolicyFunc(func(attempt int, req *http.Request, resp *Response, err error) bool {
+		return attempt == 1
+	})
+
+	anyPolicy := AnyRetryPolicy(RetryOnStatusCodes(500), RetryOnNetworkErrors())
+	c.Assert(anyPolicy.ShouldRetry(1, req, &Response{Code: 500}, nil), check.Equals, true)
+	c.Assert(anyPolicy.ShouldRetry(1, req, nil, io.EOF), check.Equals, true)
+	c.Assert(anyPolicy.ShouldRetry(1, req, &Response{Code: 200}, nil), check.Equals, false)
+
+	allPolicy := AllRetryPolicy(RetryOnStatusCodes(500), firstAttempt)
+	c.Assert(allPolicy.ShouldRetry(1, req, &Response{Code: 500}, nil), check.Equals, true)
+	c.Assert(allPolicy.ShouldRetry(2, req, &Response{Code: 500}, nil), check.Equals, false)
+	c.Assert(AllRetryPolicy().ShouldRetry(1, req, nil, io.EOF), check.Equals, false)
+}
@@ -0,0 +1,125 @@
+package gohttp
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type SigningTest struct{}
+
+var _ = check.Suite(&SigningTest{})
+
+// sigV4TestSigner uses the credentials of the AWS Signature Version 4 test
+// suite.
+func sigV4TestSigner(service string) *SigV4Signer {
+	return &SigV4Signer{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		Region:          "us-east-1",
+		Service:         service,
+		Now: func() time.Time {
+			return time.Date(2015, time.August, 30, 12, 36, 0, 0, time.UTC)
+		},
+	}
+}
+
+func (s *SigningTest) TestSigV4GetVanilla(c *check.C) {
+	req, _ := http.NewRequest(GET, "https://example.amazonaws.com/", nil)
+	c.Assert(sigV4TestSigner("service").Authenticate(req), check.IsNil)
+	c.Assert(req.Header.Get("X-Amz-Date"), check.Equals, "20150830T123600Z")
+	c.Assert(req.Header.Get(Authorization), check.Equals, "AWS4-HMAC-SHA256 "+
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31")
+}
+
+func (s *SigningTest) TestSigV4GetVanillaQueryOrder(c *check.C) {
+	req, _ := http.NewRequest(GET, "https://example.amazonaws.com/?Param2=value2&Param1=value1", nil)
+	c.Assert(sigV4TestSigner("service").Authenticate(req), check.IsNil)
+	c.Assert(req.Header.Get(Authorization), check.Equals, "AWS4-HMAC-SHA256 "+
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500")
+}
+
+func (s *SigningTest) TestSigV4PostVanilla(c *check.C) {
+	req, _ := http.NewRequest(POST, "https://example.amazonaws.com/", nil)
+	c.Assert(sigV4TestSigner("service").Authenticate(req), check.IsNil)
+	c.Assert(req.Header.Get(Authorization), check.Equals, "AWS4-HMAC-SHA256 "+
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, "+
+		"Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b")
+}
+
+func (s *SigningTest) TestSigV4IAMListUsers(c *check.C) {
+	req, _ := http.NewRequest(GET, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	req.Header.Set(ContentType, "application/x-www-form-urlencoded; charset=utf-8")
+	c.Assert(sigV4TestSigner("iam").Authenticate(req), check.IsNil)
+	c.Assert(req.Header.Get(Authorization), check.Equals, "AWS4-HMAC-SHA256 "+
+		"Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+		"SignedHeaders=content-type;host;x-amz-date, "+
+		"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7")
+}
+
+func (s *SigningTest) TestSigV4SignsBody(c *check.C) {
+	req, _ := http.NewRequest(POST, "https://example.amazonaws.com/", strings.NewReader("Param1=value1"))
+	req.Header.Set(ContentType, "application/x-www-form-urlencoded")
+	signer := sigV4TestSigner("s3")
+	c.Assert(signer.Authenticate(req), check.IsNil)
+	c.Assert(req.Header.Get("X-Amz-Content-Sha256"), check.Equals, hashHex([]byte("Param1=value1")))
+	c.Assert(strings.Contains(req.Header.Get(Authorization), "SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date"), check.Equals, true)
+}
+
+func (s *SigningTest) TestHMACSignerIsDeterministic(c *check.C) {
+	signer := &HMACSigner{
+		KeyID:         "key",
+		Secret:        []byte("secret"),
+		SignedHeaders: []string{ContentType},
+		Now: func() time.Time {
+			return time.Date(2015, time.August, 30, 12, 36, 0, 0, time.UTC)
+		},
+	}
+
+	sign := func(rawURL string, body string) string {
+		req, _ := http.NewRequest(POST, rawURL, strings.NewReader(body))
+		req.Header.Set(ContentType, "application/json")
+		c.Assert(signer.Authenticate(req), check.IsNil)
+		c.Assert(req.Header.Get("Date"), check.Equals, "Sun, 30 Aug 2015 12:36:00 GMT")
+		return req.Header.Get(Authorization)
+	}
+
+	signature := sign("https://api.example.com/users?b=2&a=1", `{"name":"test"}`)
+	c.Assert(strings.HasPrefix(signature, "HMAC-SHA256 KeyId=key, SignedHeaders=content-type;date;host, Signature="), check.Equals, true)
+	c.Assert(sign("https://api.example.com/users?a=1&b=2", `{"name":"test"}`), check.Equals, signature)
+	c.Assert(sign("https://api.example.com/users?a=1&b=2", `{"name":"other"}`), check.Not(check.Equals), signature)
+	c.Assert(sign("https://api.example.com/groups?a=1&b=2", `{"name":"test"}`), check.Not(check.Equals), signature)
+}
+
+func (s *SigningTest) TestHMACSignerResignsWithFreshDate(c *check.C) {
+	now := time.Date(2015, time.August, 30, 12, 36, 0, 0, time.UTC)
+	signer := &HMACSigner{
+		KeyID:  "key",
+		Secret: []byte("secret"),
+		Now: func() time.Time {
+			return now
+		},
+	}
+
+	req, _ := http.NewRequest(GET, "https://api.example.com/users", nil)
+	c.Assert(signer.Authenticate(req), check.IsNil)
+	first := req.Header.Get(Authorization)
+
+	// A retry of the same request is signed again a minute later.
+	now = now.Add(time.Minute)
+	c.Assert(signer.Authenticate(req), check.IsNil)
+	c.Assert(req.Header.Get("Date"), check.Equals, "Sun, 30 Aug 2015 12:37:00 GMT")
+	c.Assert(req.Header.Get(Authorization), check.Not(check.Equals), first)
+}
+
+func (s *SigningTest) TestCanonicalQuery(c *check.C) {
+	c.Assert(canonicalQuery("b=2&a=3&a=1&c=x y"), check.Equals, "a=1&a=3&b=2&c=x%20y")
+	c.Assert(canonicalQuery(""), check.Equals, "")
+}
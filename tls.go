@@ -0,0 +1,257 @@
+package gohttp
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrPinMismatch is returned by the TLS handshake when none of the
+// certificates presented by the server matches a pinned public key.
+var ErrPinMismatch = errors.New("gohttp: server certificate does not match any pinned public key")
+
+//------------------------------------------------------------------------------
+// TLS Options
+//------------------------------------------------------------------------------
+
+// WithTLSConfig sets the base TLS configuration of the client. The other TLS
+// options are applied on top of it. The supplied config is not modified.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(o *clientOptions) {
+		o.tune = append(o.tune, func(t *http.Transport) {
+			t.TLSClientConfig = config.Clone()
+		})
+	}
+}
+
+// WithMinTLSVersion sets the minimum TLS version accepted by the client, such
+// as `tls.VersionTLS12`.
+func WithMinTLSVersion(version uint16) Option {
+	return func(o *clientOptions) {
+		o.tlsTune = append(o.tlsTune, func(config *tls.Config) {
+			config.MinVersion = version
+		})
+	}
+}
+
+// WithRootCAs sets the certificate authorities used to verify servers,
+// instead of the system pool.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(o *clientOptions) {
+		o.tlsTune = append(o.tlsTune, func(config *tls.Config) {
+			config.RootCAs = pool
+		})
+	}
+}
+
+// WithClientCertificate presents the supplied certificate to servers that
+// request one.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(o *clientOptions) {
+		o.tlsTune = append(o.tlsTune, func(config *tls.Config) {
+			config.Certificates = []tls.Certificate{cert}
+			config.GetClientCertificate = nil
+		})
+	}
+}
+
+// WithClientCertificatePEM presents the PEM encoded certificate and key to
+// servers that request one. An invalid pair fails the TLS handshake.
+func WithClientCertificatePEM(certPEM []byte, keyPEM []byte) Option {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	return func(o *clientOptions) {
+		o.tlsTune = append(o.tlsTune, func(config *tls.Config) {
+			config.Certificates = nil
+			config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				if err != nil {
+					return nil, err
+				}
+				return &cert, nil
+			}
+		})
+	}
+}
+
+// WithClientCertificateFiles presents the certificate and key stored in the
+// supplied PEM files to servers that request one. The files are watched, so a
+// rotated certificate is picked up by the next TLS handshake.
+func WithClientCertificateFiles(certFile string, keyFile string) Option {
+	return WithCertificateReloader(&CertificateReloader{certFile: certFile, keyFile: keyFile})
+}
+
+// WithCertificateReloader presents the certificate held by reloader to servers
+// that request one.
+func WithCertificateReloader(reloader *CertificateReloader) Option {
+	return func(o *clientOptions) {
+		o.tlsTune = append(o.tlsTune, func(config *tls.Config) {
+			config.Certificates = nil
+			config.GetClientCertificate = reloader.GetClientCertificate
+		})
+	}
+}
+
+// WithPinnedPublicKeys only accepts servers presenting a certificate whose
+// public key matches one of the supplied pins. A pin is the base64 encoded
+// SHA-256 hash of the DER encoded SubjectPublicKeyInfo, as returned by
+// SPKIHash. Pinning is checked in addition to the regular verification,
+// against the certificates of the verified chain. When verification is
+// disabled with InsecureSkipVerify, only the leaf certificate can match.
+func WithPinnedPublicKeys(pins ...string) Option {
+	return func(o *clientOptions) {
+		o.tlsTune = append(o.tlsTune, func(config *tls.Config) {
+			config.VerifyConnection = verifyPins(pins)
+		})
+	}
+}
+
+//------------------------------------------------------------------------------
+// Certificate Helpers
+//------------------------------------------------------------------------------
+
+// NewCertPool builds a certificate pool from PEM encoded certificates.
+func NewCertPool(pemCerts ...[]byte) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, pemCert := range pemCerts {
+		if !pool.AppendCertsFromPEM(pemCert) {
+			return nil, errors.New("gohttp: no certificate found in PEM data")
+		}
+	}
+	return pool, nil
+}
+
+// LoadCertPool builds a certificate pool from files holding PEM encoded
+// certificates.
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pemCerts := make([][]byte, len(files))
+	for i, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pemCerts[i] = data
+	}
+	return NewCertPool(pemCerts...)
+}
+
+// SPKIHash returns the pin of a certificate: the base64 encoded SHA-256 hash
+// of its DER encoded SubjectPublicKeyInfo.
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// verifyPins matches the pins against the verified chains of the server, so
+// that a certificate the server merely appends to its chain cannot satisfy
+// them. When verification is skipped, only the leaf certificate is checked.
+func verifyPins(pins []string) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		chains := state.VerifiedChains
+		if len(chains) == 0 && len(state.PeerCertificates) > 0 {
+			chains = [][]*x509.Certificate{state.PeerCertificates[:1]}
+		}
+
+		for _, chain := range chains {
+			for _, cert := range chain {
+				hash := SPKIHash(cert)
+				for _, pin := range pins {
+					if pin == hash {
+						return nil
+					}
+				}
+			}
+		}
+		return ErrPinMismatch
+	}
+}
+
+//------------------------------------------------------------------------------
+// Certificate Reloader
+//------------------------------------------------------------------------------
+
+// CertificateReloader holds a client certificate loaded from a pair of PEM
+// files and reloads it when the files change, so that rotated certificates
+// are used without recreating the client.
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	// mutex guards the fields below.
+	mutex   sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertificateReloader loads the certificate and key stored in the supplied
+// PEM files.
+func NewCertificateReloader(certFile string, keyFile string) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// Reload loads the certificate and key from their files.
+func (r *CertificateReloader) Reload() error {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("gohttp: loading client certificate: %w", err)
+	}
+
+	r.mutex.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mutex.Unlock()
+	return nil
+}
+
+// GetClientCertificate returns the current certificate, reloading it first if
+// its files changed. If the reload fails, for instance while the files are
+// being rotated, the previous certificate keeps being used. It is meant for
+// `tls.Config.GetClientCertificate`.
+func (r *CertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	modTime, statErr := r.latestModTime()
+
+	r.mutex.Lock()
+	stale := r.cert == nil || (statErr == nil && modTime.After(r.modTime))
+	r.mutex.Unlock()
+
+	var reloadErr error
+	if stale {
+		reloadErr = r.Reload()
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.cert == nil {
+		return nil, reloadErr
+	}
+	return r.cert, nil
+}
+
+func (r *CertificateReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
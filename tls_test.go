@@ -0,0 +1,218 @@
+package gohttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+type TLSTest struct {
+	server *httptest.Server
+}
+
+var _ = check.Suite(&TLSTest{})
+
+func (t *TLSTest) SetUpSuite(c *check.C) {
+	t.server = httptest.NewUnstartedServer(http.HandlerFunc(HandleClientCertificate))
+	t.server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	t.server.StartTLS()
+}
+
+func (t *TLSTest) TearDownSuite(c *check.C) {
+	t.server.Close()
+}
+
+func (t *TLSTest) serverPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(t.server.Certificate())
+	return pool
+}
+
+func (t *TLSTest) TestUnknownAuthorityIsRejected(c *check.C) {
+	client := NewClient(t.server.URL, nil)
+	_, err := client.Execute(&Request{Method: GET, URL: "/"})
+	c.Assert(err, check.NotNil)
+}
+
+func (t *TLSTest) TestCustomRootCAs(c *check.C) {
+	client := NewClient(t.server.URL, nil, WithRootCAs(t.serverPool()), WithMinTLSVersion(tls.VersionTLS12))
+	response, err := client.Execute(&Request{Method: GET, URL: "/"})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+	c.Assert(client.HTTPClient().Transport.(*http.Transport).TLSClientConfig.MinVersion, check.Equals, uint16(tls.VersionTLS12))
+}
+
+func (t *TLSTest) TestRootCAsFromPEM(c *check.C) {
+	pemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: t.server.Certificate().Raw})
+	pool, err := NewCertPool(pemCert)
+	c.Assert(err, check.IsNil)
+
+	client := NewClient(t.server.URL, nil, WithRootCAs(pool))
+	response, err := client.Execute(&Request{Method: GET, URL: "/"})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+
+	_, err = NewCertPool([]byte("not a certificate"))
+	c.Assert(err, check.NotNil)
+}
+
+func (t *TLSTest) TestPinnedPublicKeys(c *check.C) {
+	pin := SPKIHash(t.server.Certificate())
+	client := NewClient(t.server.URL, nil, WithRootCAs(t.serverPool()), WithPinnedPublicKeys("other", pin))
+	response, err := client.Execute(&Request{Method: GET, URL: "/"})
+	c.Assert(err, check.IsNil)
+	c.Assert(response.Code, check.Equals, http.StatusOK)
+
+	client = NewClient(t.server.URL, nil, WithRootCAs(t.serverPool()), WithPinnedPublicKeys("other"))
+	_, err = client.Execute(&Request{Method: GET, URL: "/"})
+	c.Assert(err, check.ErrorMatches, ".*"+ErrPinMismatch.Error())
+}
+
+func (t *TLSTest) TestPinsIgnoreUnverifiedCertificates(c *check.C) {
+	ca, caKey := newCertificate(c, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	leaf, leafKey := newCertificate(c, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "leaf"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	pinned, _ := newCertificate(c, &x509.Certificate{Subject: pkix.Name{CommonName: "pinned"}}, nil, nil)
+
+	// The server appends the pinned certificate to a chain it does not belong
+	// to.
+	server := httptest.NewUnstartedServer(http.HandlerFunc(HandleClientCertificate))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{
+		Certificate: [][]byte{leaf.Raw, pinned.Raw},
+		PrivateKey:  leafKey,
+	}}}
+	server.StartTLS()
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	client := NewClient(server.URL, nil, WithRootCAs(pool), WithPinnedPublicKeys(SPKIHash(pinned)))
+	_, err := client.Execute(&Request{Method: GET, URL: "/"})
+	c.Assert(err, check.ErrorMatches, ".*"+ErrPinMismatch.Error())
+
+	client = NewClient(server.URL, nil, WithRootCAs(pool), WithPinnedPublicKeys(SPKIHash(ca)))
+	_, err = client.Execute(&Request{Method: GET, URL: "/"})
+	c.Assert(err, check.IsNil)
+
+	// Without verification, only the leaf can match.
+	insecure := &tls.Config{InsecureSkipVerify: true}
+	client = NewClient(server.URL, nil, WithTLSConfig(insecure), WithPinnedPublicKeys(SPKIHash(pinned)))
+	_, err = client.Execute(&Request{Method: GET, URL: "/"})
+	c.Assert(err, check.ErrorMatches, ".*"+ErrPinMismatch.Error())
+
+	client = NewClient(server.URL, nil, WithTLSConfig(insecure), WithPinnedPublicKeys(SPKIHash(leaf)))
+	_, err = client.Execute(&Request{Method: GET, URL: "/"})
+	c.Assert(err, check.IsNil)
+}
+
+func (t *TLSTest) TestClientCertificatePEM(c *check.C) {
+	certPEM, keyPEM := newClientCertificate(c, "in-memory")
+	client := NewClient(t.server.URL, nil, WithRootCAs(t.serverPool()), WithClientCertificatePEM(certPEM, keyPEM))
+	response, err := client.Execute(&Request{Method: GET, URL: "/"})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(response.Data), check.Equals, "in-memory")
+}
+
+func (t *TLSTest) TestClientCertificateRotation(c *check.C) {
+	dir := c.MkDir()
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	writeClientCertificate(c, certFile, keyFile, "first", time.Now().Add(-time.Minute))
+
+	reloader, err := NewCertificateReloader(certFile, keyFile)
+	c.Assert(err, check.IsNil)
+	client := NewClient(t.server.URL, nil, WithRootCAs(t.serverPool()), WithCertificateReloader(reloader))
+	response, err := client.Execute(&Request{Method: GET, URL: "/"})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(response.Data), check.Equals, "first")
+
+	// Rotate the certificate and force a new TLS handshake.
+	writeClientCertificate(c, certFile, keyFile, "second", time.Now())
+	client.HTTPClient().CloseIdleConnections()
+
+	response, err = client.Execute(&Request{Method: GET, URL: "/"})
+	c.Assert(err, check.IsNil)
+	c.Assert(string(response.Data), check.Equals, "second")
+}
+
+//------------------------------------------------------------------------------
+// Helpers
+//------------------------------------------------------------------------------
+
+func HandleClientCertificate(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}
+}
+
+// newCertificate creates a certificate from template, signed by parent, or
+// self-signed when parent is nil.
+func newCertificate(c *check.C, template *x509.Certificate, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, check.IsNil)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	c.Assert(err, check.IsNil)
+	cert, err := x509.ParseCertificate(der)
+	c.Assert(err, check.IsNil)
+	return cert, key
+}
+
+func newClientCertificate(c *check.C, commonName string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, check.IsNil)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, check.IsNil)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, check.IsNil)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM
+}
+
+func writeClientCertificate(c *check.C, certFile string, keyFile string, commonName string, modTime time.Time) {
+	certPEM, keyPEM := newClientCertificate(c, commonName)
+	c.Assert(ioutil.WriteFile(certFile, certPEM, 0600), check.IsNil)
+	c.Assert(ioutil.WriteFile(keyFile, keyPEM, 0600), check.IsNil)
+	c.Assert(os.Chtimes(certFile, modTime, modTime), check.IsNil)
+	c.Assert(os.Chtimes(keyFile, modTime, modTime), check.IsNil)
+}